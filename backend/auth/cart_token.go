@@ -0,0 +1,23 @@
+package auth
+
+// A guest's cart token is sent in this header, or failing that this cookie.
+const (
+	CartTokenHeader = "X-Cart-Token"
+	CartTokenCookie = "cart_token"
+)
+
+// NewCartToken returns a new opaque token identifying a guest's cart, and the
+// hash to store in its place.
+func NewCartToken() (string, string, error) {
+	token, err := randomToken()
+	if err != nil {
+		return "", "", err
+	}
+	return token, hashToken(token), nil
+}
+
+// HashCartToken returns the stored form of a guest cart token. Like refresh
+// tokens, cart tokens are stored hashed.
+func HashCartToken(token string) string {
+	return hashToken(token)
+}
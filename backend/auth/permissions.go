@@ -0,0 +1,30 @@
+package auth
+
+import "shopping-cart/models"
+
+type Permission string
+
+const (
+	PermManageCatalogue  Permission = "catalogue:manage"
+	PermManageOrders     Permission = "orders:manage"
+	PermManageUsers      Permission = "users:manage"
+	PermManagePromotions Permission = "promotions:manage"
+	PermManageShipping   Permission = "shipping:manage"
+)
+
+var rolePermissions = map[string][]Permission{
+	models.RoleCustomer: {},
+	models.RoleStaff:    {PermManageCatalogue, PermManageOrders, PermManagePromotions, PermManageShipping},
+	models.RoleAdmin:    {PermManageCatalogue, PermManageOrders, PermManageUsers, PermManagePromotions, PermManageShipping},
+}
+
+// HasPermission reports whether the role grants the permission. Unknown roles
+// have no permissions.
+func HasPermission(role string, perm Permission) bool {
+	for _, granted := range rolePermissions[role] {
+		if granted == perm {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,172 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"shopping-cart/config"
+	"shopping-cart/models"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+var (
+	ErrRefreshTokenInvalid = errors.New("refresh token is invalid")
+	ErrRefreshTokenExpired = errors.New("refresh token has expired")
+	ErrRefreshTokenReused  = errors.New("refresh token has already been used")
+	ErrSessionRevoked      = errors.New("session has been revoked")
+)
+
+// TokenPair is what a client receives after logging in or refreshing.
+type TokenPair struct {
+	AccessToken      string
+	AccessExpiresAt  time.Time
+	RefreshToken     string
+	RefreshExpiresAt time.Time
+	SessionID        int
+}
+
+// StartSession opens a new session for the user and issues its first token
+// pair.
+func StartSession(userID int) (*TokenPair, error) {
+	var pair *TokenPair
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		session := models.Session{UserID: userID}
+		if err := tx.Create(&session).Error; err != nil {
+			return err
+		}
+
+		var err error
+		pair, err = issuePair(tx, userID, session.ID)
+		return err
+	})
+	return pair, err
+}
+
+// RotateRefreshToken exchanges a refresh token for a new pair. The presented
+// token is consumed; presenting it again revokes the whole session, since it
+// means the token has leaked.
+func RotateRefreshToken(rawToken string) (*TokenPair, error) {
+	var stored models.RefreshToken
+	if err := config.DB.Where("token_hash = ?", hashToken(rawToken)).First(&stored).Error; err != nil {
+		return nil, ErrRefreshTokenInvalid
+	}
+
+	var session models.Session
+	if err := config.DB.First(&session, stored.SessionID).Error; err != nil {
+		return nil, ErrRefreshTokenInvalid
+	}
+	if session.RevokedAt != nil {
+		return nil, ErrSessionRevoked
+	}
+
+	now := time.Now()
+	if now.After(stored.ExpiresAt) {
+		return nil, ErrRefreshTokenExpired
+	}
+
+	var pair *TokenPair
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		// Only one caller can mark the token used; anyone else is replaying it.
+		result := tx.Model(&models.RefreshToken{}).
+			Where("id = ? AND used_at IS NULL", stored.ID).
+			Update("used_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrRefreshTokenReused
+		}
+
+		var err error
+		pair, err = issuePair(tx, session.UserID, session.ID)
+		return err
+	})
+	if errors.Is(err, ErrRefreshTokenReused) {
+		if revokeErr := RevokeSession(session.ID); revokeErr != nil {
+			return nil, revokeErr
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return pair, nil
+}
+
+// RevokeSession ends a single session.
+func RevokeSession(sessionID int) error {
+	return config.DB.Model(&models.Session{}).
+		Where("id = ? AND revoked_at IS NULL", sessionID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// RevokeAllSessions ends every session the user has open.
+func RevokeAllSessions(userID int) error {
+	return config.DB.Model(&models.Session{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
+
+// SessionActive reports whether the session exists and has not been revoked.
+func SessionActive(sessionID int) bool {
+	var session models.Session
+	if err := config.DB.First(&session, sessionID).Error; err != nil {
+		return false
+	}
+	return session.RevokedAt == nil
+}
+
+func issuePair(tx *gorm.DB, userID, sessionID int) (*TokenPair, error) {
+	// The role is read on every issue so role changes apply from the next
+	// refresh onwards.
+	var user models.User
+	if err := tx.First(&user, userID).Error; err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := randomToken()
+	if err != nil {
+		return nil, err
+	}
+
+	refreshExpiresAt := time.Now().Add(config.Auth.RefreshTokenTTL)
+	stored := models.RefreshToken{
+		SessionID: sessionID,
+		TokenHash: hashToken(refreshToken),
+		ExpiresAt: refreshExpiresAt,
+	}
+	if err := tx.Create(&stored).Error; err != nil {
+		return nil, err
+	}
+
+	accessToken, accessExpiresAt, err := IssueAccessToken(userID, sessionID, user.Role)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:      accessToken,
+		AccessExpiresAt:  accessExpiresAt,
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: refreshExpiresAt,
+		SessionID:        sessionID,
+	}, nil
+}
+
+func randomToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// Refresh tokens are stored hashed so a database leak does not hand out
+// working credentials.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,16 @@
+package auth
+
+// NewShareToken returns a new unguessable token for a public share link,
+// and the hash to store in its place.
+func NewShareToken() (string, string, error) {
+	token, err := randomToken()
+	if err != nil {
+		return "", "", err
+	}
+	return token, hashToken(token), nil
+}
+
+// HashShareToken returns the stored form of a share link token.
+func HashShareToken(token string) string {
+	return hashToken(token)
+}
@@ -0,0 +1,80 @@
+package auth
+
+import (
+	"errors"
+	"shopping-cart/config"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrTokenExpired = errors.New("token has expired")
+	ErrTokenInvalid = errors.New("token is invalid")
+)
+
+// Claims are the JWT claims carried by an access token. The subject holds the
+// user ID, SessionID ties the token to the login it was issued for and Role
+// is the user's role at the time the token was issued.
+type Claims struct {
+	SessionID int    `json:"sid"`
+	Role      string `json:"role"`
+	jwt.RegisteredClaims
+}
+
+// UserID returns the numeric user ID stored in the subject claim.
+func (c *Claims) UserID() (int, error) {
+	return strconv.Atoi(c.Subject)
+}
+
+// IssueAccessToken signs a new access token for the given user and session.
+func IssueAccessToken(userID, sessionID int, role string) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(config.Auth.AccessTokenTTL)
+
+	claims := Claims{
+		SessionID: sessionID,
+		Role:      role,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    config.Auth.JWTIssuer,
+			Subject:   strconv.Itoa(userID),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	signed, err := token.SignedString(config.Auth.JWTSecret)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+	return signed, expiresAt, nil
+}
+
+// ParseAccessToken verifies the signature, issuer and expiry of a token and
+// returns its claims. Expired tokens yield ErrTokenExpired; anything else that
+// fails verification yields ErrTokenInvalid.
+func ParseAccessToken(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(t *jwt.Token) (interface{}, error) {
+		return config.Auth.JWTSecret, nil
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(config.Auth.JWTIssuer),
+	)
+	if err != nil {
+		if errors.Is(err, jwt.ErrTokenExpired) {
+			return nil, ErrTokenExpired
+		}
+		return nil, ErrTokenInvalid
+	}
+	if !token.Valid || claims.ExpiresAt == nil {
+		return nil, ErrTokenInvalid
+	}
+	if _, err := claims.UserID(); err != nil {
+		return nil, ErrTokenInvalid
+	}
+	return claims, nil
+}
@@ -0,0 +1,62 @@
+package config
+
+import (
+	"log"
+	"os"
+	"time"
+)
+
+// AuthConfig holds the settings used to sign and verify access tokens.
+type AuthConfig struct {
+	JWTSecret       []byte
+	JWTIssuer       string
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	AdminUsername   string
+}
+
+var Auth AuthConfig
+
+const defaultJWTSecret = "dev-secret-change-me"
+
+// LoadAuthConfig reads the token settings from the environment, falling back
+// to development defaults when a variable is unset.
+func LoadAuthConfig() error {
+	secret := os.Getenv("JWT_SECRET")
+	if secret == "" {
+		log.Println("JWT_SECRET not set, using insecure development secret")
+		secret = defaultJWTSecret
+	}
+
+	issuer := os.Getenv("JWT_ISSUER")
+	if issuer == "" {
+		issuer = "shopping-cart"
+	}
+
+	accessTTL, err := durationFromEnv("JWT_ACCESS_TTL", 15*time.Minute)
+	if err != nil {
+		return err
+	}
+
+	refreshTTL, err := durationFromEnv("REFRESH_TOKEN_TTL", 30*24*time.Hour)
+	if err != nil {
+		return err
+	}
+
+	Auth = AuthConfig{
+		JWTSecret:       []byte(secret),
+		JWTIssuer:       issuer,
+		AccessTokenTTL:  accessTTL,
+		RefreshTokenTTL: refreshTTL,
+		AdminUsername:   os.Getenv("ADMIN_USERNAME"),
+	}
+	return nil
+}
+
+func durationFromEnv(name string, fallback time.Duration) (time.Duration, error) {
+	raw := os.Getenv(name)
+	if raw == "" {
+		return fallback, nil
+	}
+	return time.ParseDuration(raw)
+}
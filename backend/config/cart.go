@@ -0,0 +1,40 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// Rules for combining a guest cart with the user's cart at login, when both
+// hold the same item. Items only in the guest cart are always moved over.
+const (
+	CartMergeSum  = "sum"  // Add the quantities together
+	CartMergeMax  = "max"  // Keep the larger quantity
+	CartMergeUser = "user" // Keep the user cart's quantity
+)
+
+// GuestCartTTL is how long a guest cart lasts after it was last used.
+var GuestCartTTL = 7 * 24 * time.Hour
+
+// CartMergeStrategy is the rule guest carts are merged by.
+var CartMergeStrategy = CartMergeSum
+
+// LoadCartConfig reads GUEST_CART_TTL and CART_MERGE_STRATEGY from the
+// environment.
+func LoadCartConfig() error {
+	ttl, err := durationFromEnv("GUEST_CART_TTL", GuestCartTTL)
+	if err != nil {
+		return err
+	}
+	GuestCartTTL = ttl
+
+	switch strategy := os.Getenv("CART_MERGE_STRATEGY"); strategy {
+	case "":
+	case CartMergeSum, CartMergeMax, CartMergeUser:
+		CartMergeStrategy = strategy
+	default:
+		return fmt.Errorf("unknown cart merge strategy %q", strategy)
+	}
+	return nil
+}
@@ -1,7 +1,11 @@
 package config
 
 import (
+	"fmt"
+	"log"
 	"shopping-cart/models"
+	"shopping-cart/money"
+	"time"
 
 	"github.com/jinzhu/gorm"
 	_ "github.com/jinzhu/gorm/dialects/sqlite"
@@ -11,17 +15,141 @@ var DB *gorm.DB
 
 func InitDB() error {
 	var err error
-	DB, err = gorm.Open("sqlite3", "shopping_cart.db")
+	// Immediate transactions take the write lock up front, so concurrent
+	// checkouts queue behind each other instead of failing to upgrade a lock
+	DB, err = gorm.Open("sqlite3", "shopping_cart.db?_txlock=immediate")
 	if err != nil {
 		return err
 	}
 
+	// Items predating stock tracking are given the sample stock level below
+	backfillStock := DB.HasTable(&models.Item{}) && !DB.Dialect().HasColumn("items", "stock")
+	// Orders placed before line snapshots are snapshotted from their carts
+	backfillOrderItems := !DB.HasTable(&models.OrderItem{})
+	// Partially refunded orders from before refund status was kept apart go
+	// back to their fulfilment status
+	backfillRefundStatus := DB.HasTable(&models.Order{}) && !DB.Dialect().HasColumn("orders", "refund_status")
+	// Money columns added to existing tables start at zero: order lines from
+	// before coupons and per-line tax, and orders from before shipping charges
+	zeroMoneyColumns := map[string][]string{}
+	for table, columns := range map[string][]string{
+		"order_items": {"discount", "tax"},
+		"orders":      {"shipping_charge"},
+	} {
+		for _, column := range columns {
+			if DB.HasTable(table) && !DB.Dialect().HasColumn(table, column+"_amount") {
+				zeroMoneyColumns[table] = append(zeroMoneyColumns[table], column)
+			}
+		}
+	}
+	// Decimal money columns from before amounts were stored in minor units
+	legacyMoneyColumns := map[string][]string{}
+	for table, columns := range map[string][]string{
+		"items":       {"price"},
+		"orders":      {"subtotal", "tax", "discount", "total"},
+		"order_items": {"unit_price", "line_total"},
+	} {
+		if DB.Dialect().HasColumn(table, columns[0]) && !DB.Dialect().HasColumn(table, columns[0]+"_amount") {
+			legacyMoneyColumns[table] = columns
+		}
+	}
+
 	// Auto-migrate the models
 	DB.AutoMigrate(&models.User{})
+	// Usernames weren't unique at first; rename later accounts sharing one so
+	// the unique index can be added
+	if err := renameDuplicateUsers(); err != nil {
+		return err
+	}
+	if err := DB.Model(&models.User{}).AddUniqueIndex("idx_users_username", "username").Error; err != nil {
+		return err
+	}
 	DB.AutoMigrate(&models.Cart{})
 	DB.AutoMigrate(&models.Item{})
+	// Items created before the creation time was recorded are given the
+	// current time, before anything reads them
+	if err := DB.Model(&models.Item{}).Where("created_at IS NULL OR created_at = ''").
+		Update("created_at", time.Now()).Error; err != nil {
+		return err
+	}
 	DB.AutoMigrate(&models.Order{})
 	DB.AutoMigrate(&models.CartItem{})
+	// Tables created before cart lines had a composite key may hold duplicate
+	// lines; merge them so the unique index can be added
+	if err := mergeDuplicateCartItems(); err != nil {
+		return err
+	}
+	if err := DB.Model(&models.CartItem{}).AddUniqueIndex("idx_cart_items_cart_item", "cart_id", "item_id").Error; err != nil {
+		return err
+	}
+	DB.AutoMigrate(&models.Session{})
+	DB.AutoMigrate(&models.RefreshToken{})
+	DB.AutoMigrate(&models.StockAdjustment{})
+	DB.AutoMigrate(&models.OrderItem{})
+	DB.AutoMigrate(&models.IdempotencyKey{})
+	// Keys were unique per user before guests could use them
+	if DB.Dialect().HasIndex("idempotency_keys", "idx_idempotency_user_key") {
+		if err := DB.Model(&models.IdempotencyKey{}).RemoveIndex("idx_idempotency_user_key").Error; err != nil {
+			return err
+		}
+		if err := DB.Model(&models.IdempotencyKey{}).Where("cart_token_hash IS NULL").Update("cart_token_hash", "").Error; err != nil {
+			return err
+		}
+	}
+	DB.AutoMigrate(&models.OrderStatusChange{})
+	DB.AutoMigrate(&models.Coupon{})
+	DB.AutoMigrate(&models.CouponRedemption{})
+	DB.AutoMigrate(&models.Address{})
+	DB.AutoMigrate(&models.ShippingMethod{})
+	DB.AutoMigrate(&models.ShippingRegionRate{})
+	DB.AutoMigrate(&models.Payment{})
+	DB.AutoMigrate(&models.Refund{})
+	DB.AutoMigrate(&models.RefundLine{})
+	DB.AutoMigrate(&models.Wishlist{})
+	DB.AutoMigrate(&models.WishlistItem{})
+
+	for table, columns := range legacyMoneyColumns {
+		if err := convertMoneyColumns(table, columns); err != nil {
+			return err
+		}
+	}
+	for table, columns := range zeroMoneyColumns {
+		for _, column := range columns {
+			stmt := fmt.Sprintf(`UPDATE %s SET %s_amount = 0, %s_currency = ?`, table, column, column)
+			if err := DB.Exec(stmt, money.DefaultCurrency).Error; err != nil {
+				return err
+			}
+		}
+	}
+	if backfillStock {
+		if err := backfillItemStock(); err != nil {
+			return err
+		}
+	}
+	if backfillOrderItems {
+		if err := backfillOrderSnapshots(); err != nil {
+			return err
+		}
+	}
+	if backfillRefundStatus {
+		if err := backfillOrderRefundStatus(); err != nil {
+			return err
+		}
+	}
+
+	// Promote the configured bootstrap admin, if any
+	if Auth.AdminUsername != "" {
+		var admin models.User
+		err := DB.Where("username = ?", Auth.AdminUsername).First(&admin).Error
+		if err != nil && !gorm.IsRecordNotFoundError(err) {
+			return err
+		}
+		if err == nil {
+			if err := DB.Model(&admin).Update("role", models.RoleAdmin).Error; err != nil {
+				return err
+			}
+		}
+	}
 
 	// Initialize sample products if none exist
 	var count int
@@ -30,9 +158,157 @@ func InitDB() error {
 		createSampleProducts()
 	}
 
+	// Offer the standard shipping methods if none are set up
+	DB.Model(&models.ShippingMethod{}).Count(&count)
+	if count == 0 {
+		createShippingMethods()
+	}
+
+	return nil
+}
+
+// convertMoneyColumns fills the minor unit amount and currency columns of each
+// money field from its legacy decimal column, rounding to whole cents.
+func convertMoneyColumns(table string, columns []string) error {
+	for _, column := range columns {
+		stmt := fmt.Sprintf(`UPDATE %s SET %s_amount = CAST(ROUND(%s * 100) AS INTEGER), %s_currency = ?`,
+			table, column, column, column)
+		if err := DB.Exec(stmt, money.DefaultCurrency).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mergeDuplicateCartItems folds repeated (cart_id, item_id) lines into one
+// line holding their combined quantity.
+func mergeDuplicateCartItems() error {
+	type duplicate struct {
+		CartID   int
+		ItemID   int
+		Quantity int
+	}
+	var duplicates []duplicate
+	if err := DB.Raw(`SELECT cart_id, item_id, SUM(quantity) AS quantity FROM cart_items
+		GROUP BY cart_id, item_id HAVING COUNT(*) > 1`).Scan(&duplicates).Error; err != nil {
+		return err
+	}
+
+	return DB.Transaction(func(tx *gorm.DB) error {
+		for _, d := range duplicates {
+			if err := tx.Where("cart_id = ? AND item_id = ?", d.CartID, d.ItemID).Delete(&models.CartItem{}).Error; err != nil {
+				return err
+			}
+			line := models.CartItem{CartID: d.CartID, ItemID: d.ItemID, Quantity: d.Quantity}
+			if err := tx.Create(&line).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// renameDuplicateUsers keeps the first account with each username and gives
+// the others their ID as a suffix, e.g. "alice-7". Login always found the
+// first account, so the others couldn't sign in under the shared name anyway.
+func renameDuplicateUsers() error {
+	var duplicates []models.User
+	if err := DB.Where(`id NOT IN (SELECT MIN(id) FROM users GROUP BY username)`).
+		Find(&duplicates).Error; err != nil {
+		return err
+	}
+
+	for _, user := range duplicates {
+		renamed := fmt.Sprintf("%s-%d", user.Username, user.ID)
+		log.Printf("Renaming duplicate user %d from %q to %q", user.ID, user.Username, renamed)
+		if err := DB.Model(&user).Update("username", renamed).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sampleStockLevel is the starting stock for seeded items and for items that
+// existed before stock tracking was added.
+const sampleStockLevel = 100
+
+func backfillItemStock() error {
+	var items []models.Item
+	if err := DB.Find(&items).Error; err != nil {
+		return err
+	}
+
+	for _, item := range items {
+		if err := DB.Model(&item).Update("stock", sampleStockLevel).Error; err != nil {
+			return err
+		}
+		DB.Create(&models.StockAdjustment{
+			ItemID:     item.ID,
+			Delta:      sampleStockLevel,
+			StockAfter: sampleStockLevel,
+			Reason:     models.StockReasonInitial,
+		})
+	}
+	return nil
+}
+
+// backfillOrderSnapshots gives orders placed before line snapshots existed a
+// snapshot of their cart at today's prices, the closest record available.
+func backfillOrderSnapshots() error {
+	var orders []models.Order
+	if err := DB.Find(&orders).Error; err != nil {
+		return err
+	}
+
+	for _, order := range orders {
+		var cartItems []models.CartItem
+		if err := DB.Where("cart_id = ?", order.CartID).Find(&cartItems).Error; err != nil {
+			return err
+		}
+
+		var lines []models.OrderItem
+		for _, cartItem := range cartItems {
+			var item models.Item
+			if err := DB.First(&item, cartItem.ItemID).Error; err != nil {
+				continue
+			}
+			line := models.NewOrderItem(item, cartItem.Quantity)
+			line.OrderID = order.ID
+			if err := DB.Create(&line).Error; err != nil {
+				return err
+			}
+			lines = append(lines, line)
+		}
+
+		order.SetTotals(lines)
+		if err := DB.Model(&order).Updates(map[string]interface{}{
+			"subtotal_amount":   order.Subtotal.Amount,
+			"subtotal_currency": order.Subtotal.Currency,
+			"total_amount":      order.Total.Amount,
+			"total_currency":    order.Total.Currency,
+		}).Error; err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// backfillOrderRefundStatus sets the refund status of orders refunded before
+// it had its own column. Orders left partially_refunded return to the last
+// other status in their history, or paid if there is none.
+func backfillOrderRefundStatus() error {
+	if err := DB.Exec(`UPDATE orders SET refund_status = status WHERE status IN (?, ?)`,
+		models.OrderRefundPartial, models.OrderRefundFull).Error; err != nil {
+		return err
+	}
+	return DB.Exec(`UPDATE orders SET status = COALESCE((
+			SELECT to_status FROM order_status_changes
+			WHERE order_id = orders.id AND to_status <> ?
+			ORDER BY id DESC LIMIT 1), ?)
+		WHERE status = ?`,
+		models.OrderRefundPartial, models.OrderStatusPaid, models.OrderRefundPartial).Error
+}
+
 func createSampleProducts() {
 	// Available images from frontend/src/images
 	availableImages := []string{
@@ -49,7 +325,7 @@ func createSampleProducts() {
 			Name:        "X-Bud Pro",
 			Status:      "active",
 			Description: "Premium Wireless Earbuds with active noise cancellation, 24-hour battery life, and crystal clear sound quality",
-			Price:       199.99,
+			Price:       money.New(19999, money.DefaultCurrency),
 			Category:    "Earbuds",
 			Brand:       "ShopCart",
 			ImageURLs:   availableImages[0], // earphonewired.png
@@ -58,7 +334,7 @@ func createSampleProducts() {
 			Name:        "Studio Max",
 			Status:      "active",
 			Description: "Professional Studio Headphones with high-resolution audio and premium build quality",
-			Price:       299.99,
+			Price:       money.New(29999, money.DefaultCurrency),
 			Category:    "Professional",
 			Brand:       "ShopCart",
 			ImageURLs:   availableImages[1], // headphone.png
@@ -67,7 +343,7 @@ func createSampleProducts() {
 			Name:        "Bass Boost Pro",
 			Status:      "active",
 			Description: "Over-ear headphones with enhanced bass response and comfortable fit",
-			Price:       249.99,
+			Price:       money.New(24999, money.DefaultCurrency),
 			Category:    "Headphones",
 			Brand:       "ShopCart",
 			ImageURLs:   availableImages[2], // ear1.png
@@ -76,7 +352,7 @@ func createSampleProducts() {
 			Name:        "Gaming Elite",
 			Status:      "active",
 			Description: "Gaming headset with 7.1 surround sound and noise-canceling microphone",
-			Price:       349.99,
+			Price:       money.New(34999, money.DefaultCurrency),
 			Category:    "Gaming",
 			Brand:       "ShopCart",
 			ImageURLs:   availableImages[3], // ear2.avif
@@ -85,7 +361,7 @@ func createSampleProducts() {
 			Name:        "Sport Wireless",
 			Status:      "active",
 			Description: "Sweat-resistant wireless earbuds perfect for workouts and running",
-			Price:       129.99,
+			Price:       money.New(12999, money.DefaultCurrency),
 			Category:    "Sports",
 			Brand:       "ShopCart",
 			ImageURLs:   availableImages[4], // speaker1.png
@@ -94,7 +370,7 @@ func createSampleProducts() {
 			Name:        "DJ Master",
 			Status:      "active",
 			Description: "Professional DJ headphones with superior sound isolation and durability",
-			Price:       399.99,
+			Price:       money.New(39999, money.DefaultCurrency),
 			Category:    "Professional",
 			Brand:       "ShopCart",
 			ImageURLs:   availableImages[5], // speaker.jpg
@@ -103,7 +379,7 @@ func createSampleProducts() {
 			Name:        "Kids Safe",
 			Status:      "active",
 			Description: "Volume-limited headphones designed specifically for children's safety",
-			Price:       89.99,
+			Price:       money.New(8999, money.DefaultCurrency),
 			Category:    "Kids",
 			Brand:       "ShopCart",
 			ImageURLs:   availableImages[0], // earphonewired.png
@@ -112,7 +388,7 @@ func createSampleProducts() {
 			Name:        "Travel Elite",
 			Status:      "active",
 			Description: "Foldable travel headphones with active noise cancellation",
-			Price:       279.99,
+			Price:       money.New(27999, money.DefaultCurrency),
 			Category:    "Travel",
 			Brand:       "ShopCart",
 			ImageURLs:   availableImages[1], // headphone.png
@@ -121,7 +397,7 @@ func createSampleProducts() {
 			Name:        "Classic Studio",
 			Status:      "active",
 			Description: "Classic studio monitoring headphones for professional audio production",
-			Price:       449.99,
+			Price:       money.New(44999, money.DefaultCurrency),
 			Category:    "Professional",
 			Brand:       "ShopCart",
 			ImageURLs:   availableImages[2], // ear1.png
@@ -130,7 +406,7 @@ func createSampleProducts() {
 			Name:        "Workout Plus",
 			Status:      "active",
 			Description: "Over-ear workout headphones with sweat resistance and secure fit",
-			Price:       199.99,
+			Price:       money.New(19999, money.DefaultCurrency),
 			Category:    "Sports",
 			Brand:       "ShopCart",
 			ImageURLs:   availableImages[3], // ear2.avif
@@ -139,7 +415,7 @@ func createSampleProducts() {
 			Name:        "True Wireless Pro",
 			Status:      "active",
 			Description: "Premium true wireless earbuds with ambient sound mode",
-			Price:       259.99,
+			Price:       money.New(25999, money.DefaultCurrency),
 			Category:    "Earbuds",
 			Brand:       "ShopCart",
 			ImageURLs:   availableImages[4], // speaker1.png
@@ -148,14 +424,84 @@ func createSampleProducts() {
 			Name:        "Studio Reference",
 			Status:      "active",
 			Description: "Reference-grade studio headphones for mixing and mastering",
-			Price:       499.99,
+			Price:       money.New(49999, money.DefaultCurrency),
 			Category:    "Professional",
 			Brand:       "ShopCart",
 			ImageURLs:   availableImages[5], // speaker.jpg
 		},
 	}
 
+	// Typical packed weight and box size (length, width, height) per category
+	samplePackaging := map[string][4]int{
+		"Earbuds":      {150, 120, 90, 50},
+		"Headphones":   {450, 230, 200, 100},
+		"Professional": {550, 250, 220, 110},
+		"Gaming":       {600, 250, 220, 120},
+		"Sports":       {200, 150, 100, 60},
+		"Kids":         {250, 200, 180, 80},
+		"Travel":       {350, 200, 180, 70},
+	}
+
 	for _, item := range sampleItems {
+		item.Stock = sampleStockLevel
+		packaging := samplePackaging[item.Category]
+		item.WeightGrams, item.LengthMM, item.WidthMM, item.HeightMM = packaging[0], packaging[1], packaging[2], packaging[3]
 		DB.Create(&item)
+		DB.Create(&models.StockAdjustment{
+			ItemID:     item.ID,
+			Delta:      sampleStockLevel,
+			StockAfter: sampleStockLevel,
+			Reason:     models.StockReasonInitial,
+		})
 	}
 }
+
+func createShippingMethods() {
+	usd := func(amount int64) money.Money { return money.New(amount, money.DefaultCurrency) }
+
+	methods := []models.ShippingMethod{
+		{
+			Code:      models.ShippingStandard,
+			Name:      "Standard",
+			BaseRate:  usd(499),
+			PerKgRate: usd(100),
+			FreeOver:  usd(10000),
+			MinDays:   3,
+			MaxDays:   7,
+			Active:    true,
+		},
+		{
+			Code:           models.ShippingExpress,
+			Name:           "Express",
+			BaseRate:       usd(1499),
+			PerKgRate:      usd(250),
+			FreeOver:       usd(0),
+			MaxWeightGrams: 20000,
+			Regions:        "US,CA",
+			MinDays:        1,
+			MaxDays:        2,
+			Active:         true,
+		},
+		{
+			Code:      models.ShippingPickup,
+			Name:      "Store pickup",
+			BaseRate:  usd(0),
+			PerKgRate: usd(0),
+			FreeOver:  usd(0),
+			Regions:   "US-CA",
+			Active:    true,
+		},
+	}
+
+	for i := range methods {
+		DB.Create(&methods[i])
+	}
+
+	// Standard shipping to Canada costs more
+	DB.Create(&models.ShippingRegionRate{
+		MethodID:  methods[0].ID,
+		Region:    "CA",
+		BaseRate:  usd(999),
+		PerKgRate: usd(200),
+	})
+}
@@ -0,0 +1,17 @@
+package config
+
+import "time"
+
+// IdempotencyKeyTTL is how long a stored response is replayed for repeats of
+// its Idempotency-Key.
+var IdempotencyKeyTTL = 24 * time.Hour
+
+// LoadIdempotencyConfig reads IDEMPOTENCY_KEY_TTL from the environment.
+func LoadIdempotencyConfig() error {
+	ttl, err := durationFromEnv("IDEMPOTENCY_KEY_TTL", IdempotencyKeyTTL)
+	if err != nil {
+		return err
+	}
+	IdempotencyKeyTTL = ttl
+	return nil
+}
@@ -0,0 +1,22 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"shopping-cart/payment"
+)
+
+// Payments takes payment for orders.
+var Payments payment.Provider
+
+// LoadPaymentConfig sets up the payment provider named by PAYMENT_PROVIDER.
+// Only "fake" (the default), a local stand-in for a gateway, is available.
+func LoadPaymentConfig() error {
+	switch provider := os.Getenv("PAYMENT_PROVIDER"); provider {
+	case "", "fake":
+		Payments = payment.NewFakeGateway()
+	default:
+		return fmt.Errorf("unknown payment provider %q", provider)
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package config
+
+import (
+	"shopping-cart/models"
+	"shopping-cart/search"
+)
+
+var Search search.Searcher
+
+// InitSearch opens the item search index and rebuilds it from the items
+// table, so it is in sync with any rows written while the server was down.
+func InitSearch() error {
+	searcher, err := search.NewSQLiteSearcher(DB)
+	if err != nil {
+		return err
+	}
+
+	var items []models.Item
+	if err := DB.Where("status = ?", models.ItemStatusActive).Find(&items).Error; err != nil {
+		return err
+	}
+	if err := searcher.Rebuild(items); err != nil {
+		return err
+	}
+
+	Search = searcher
+	return nil
+}
@@ -0,0 +1,52 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"shopping-cart/tax"
+	"strconv"
+)
+
+// Tax calculates the tax on cart and order lines.
+var Tax tax.Calculator
+
+// TaxRegion is the region carts are taxed for when the shopper has no default
+// address, e.g. "US-CA". Orders are taxed for their shipping address.
+var TaxRegion string
+
+// LoadTaxConfig sets up the tax calculator. TAX_RULES_FILE names a JSON table
+// of rates by region and category; without it a single TAX_RATE_BPS rate
+// (default 0) applies to everything, with TAX_INCLUSIVE=true meaning prices
+// already include it. TAX_REGION sets TaxRegion.
+func LoadTaxConfig() error {
+	TaxRegion = os.Getenv("TAX_REGION")
+
+	if path := os.Getenv("TAX_RULES_FILE"); path != "" {
+		table, err := tax.LoadTable(path)
+		if err != nil {
+			return err
+		}
+		Tax = table
+		return nil
+	}
+
+	var rate int64
+	if raw := os.Getenv("TAX_RATE_BPS"); raw != "" {
+		var err error
+		if rate, err = strconv.ParseInt(raw, 10, 64); err != nil {
+			return err
+		}
+		if rate < 0 {
+			return fmt.Errorf("TAX_RATE_BPS must not be negative, got %d", rate)
+		}
+	}
+	inclusive := false
+	if raw := os.Getenv("TAX_INCLUSIVE"); raw != "" {
+		var err error
+		if inclusive, err = strconv.ParseBool(raw); err != nil {
+			return err
+		}
+	}
+	Tax = tax.NewFlatRate(rate, inclusive)
+	return nil
+}
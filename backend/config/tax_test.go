@@ -0,0 +1,16 @@
+package config
+
+import "testing"
+
+func TestLoadTaxConfigRejectsNegativeRate(t *testing.T) {
+	t.Setenv("TAX_RULES_FILE", "")
+	t.Setenv("TAX_RATE_BPS", "-825")
+	if err := LoadTaxConfig(); err == nil {
+		t.Error("LoadTaxConfig accepted a negative TAX_RATE_BPS")
+	}
+
+	t.Setenv("TAX_RATE_BPS", "825")
+	if err := LoadTaxConfig(); err != nil {
+		t.Errorf("LoadTaxConfig rejected TAX_RATE_BPS=825: %v", err)
+	}
+}
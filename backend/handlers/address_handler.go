@@ -0,0 +1,313 @@
+package handlers
+
+import (
+	"net/http"
+	"shopping-cart/config"
+	"shopping-cart/models"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+// addressInput is the body of an address create or update. IsDefault is nil
+// when is_default is left out.
+type addressInput struct {
+	models.PostalAddress
+	IsDefault *bool `json:"is_default"`
+}
+
+// normalizeAddress trims every field and upper-cases the codes, so postal
+// codes are matched and stored in one form.
+func normalizeAddress(address models.PostalAddress) models.PostalAddress {
+	return models.PostalAddress{
+		Name:       strings.TrimSpace(address.Name),
+		Line1:      strings.TrimSpace(address.Line1),
+		Line2:      strings.TrimSpace(address.Line2),
+		City:       strings.TrimSpace(address.City),
+		Region:     strings.ToUpper(strings.TrimSpace(address.Region)),
+		PostalCode: strings.ToUpper(strings.TrimSpace(address.PostalCode)),
+		Country:    strings.ToUpper(strings.TrimSpace(address.Country)),
+		Phone:      strings.TrimSpace(address.Phone),
+	}
+}
+
+// validateAddress returns a message describing the first invalid field, or
+// an empty string if the address can be shipped to.
+func validateAddress(address models.PostalAddress) string {
+	if address.Name == "" {
+		return "Name is required"
+	}
+	if address.Line1 == "" {
+		return "Address line 1 is required"
+	}
+	if address.City == "" {
+		return "City is required"
+	}
+
+	country, ok := models.ShippingCountries[address.Country]
+	if !ok {
+		codes := make([]string, 0, len(models.ShippingCountries))
+		for code := range models.ShippingCountries {
+			codes = append(codes, code)
+		}
+		sort.Strings(codes)
+		return "Unsupported country, must be one of: " + strings.Join(codes, ", ")
+	}
+	if country.RegionRequired && address.Region == "" {
+		return "Region is required for " + address.Country
+	}
+	if !country.PostalCode.MatchString(address.PostalCode) {
+		return "Postal code is not valid for " + address.Country
+	}
+	return ""
+}
+
+// setDefaultAddress makes the address the user's only default within tx.
+func setDefaultAddress(tx *gorm.DB, userID, addressID int) error {
+	if err := tx.Model(&models.Address{}).
+		Where("user_id = ? AND id <> ?", userID, addressID).
+		Update("is_default", false).Error; err != nil {
+		return err
+	}
+	return tx.Model(&models.Address{}).Where("id = ?", addressID).Update("is_default", true).Error
+}
+
+// promoteNextAddress makes the user's most recently added address, other
+// than exceptID, their default within tx. It reports false if they have no
+// other address.
+func promoteNextAddress(tx *gorm.DB, userID, exceptID int) (bool, error) {
+	var next models.Address
+	err := tx.Where("user_id = ? AND id <> ?", userID, exceptID).Order("id DESC").First(&next).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, setDefaultAddress(tx, next.UserID, next.ID)
+}
+
+// defaultAddress returns the user's default address, if they have one.
+func defaultAddress(db *gorm.DB, userID int) (models.Address, bool, error) {
+	var address models.Address
+	err := db.Where("user_id = ? AND is_default = ?", userID, true).First(&address).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return address, false, nil
+	}
+	return address, err == nil, err
+}
+
+// findAddressParam loads the address named in the URL. Addresses belonging
+// to someone else are reported as not found.
+func findAddressParam(c *gin.Context, userID int) (models.Address, bool) {
+	var address models.Address
+	addressID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid address ID"})
+		return address, false
+	}
+
+	if err := config.DB.Where("id = ? AND user_id = ?", addressID, userID).First(&address).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Address not found"})
+		return address, false
+	}
+	return address, true
+}
+
+// ListAddresses returns the user's address book, default address first.
+func ListAddresses(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	addresses := []models.Address{}
+	if err := config.DB.Where("user_id = ?", userID).Order("is_default DESC, id").Find(&addresses).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching addresses"})
+		return
+	}
+
+	c.JSON(http.StatusOK, addresses)
+}
+
+func GetAddress(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	address, ok := findAddressParam(c, userID.(int))
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, address)
+}
+
+// CreateAddress adds an address to the user's book. A user's first address
+// becomes their default.
+func CreateAddress(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var input addressInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	address := models.Address{
+		UserID:        userID.(int),
+		PostalAddress: normalizeAddress(input.PostalAddress),
+		IsDefault:     input.IsDefault != nil && *input.IsDefault,
+	}
+	if msg := validateAddress(address.PostalAddress); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if !address.IsDefault {
+			_, hasDefault, err := defaultAddress(tx, address.UserID)
+			if err != nil {
+				return err
+			}
+			address.IsDefault = !hasDefault
+		}
+
+		if err := tx.Create(&address).Error; err != nil {
+			return err
+		}
+		if address.IsDefault {
+			return setDefaultAddress(tx, address.UserID, address.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating address"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, address)
+}
+
+// UpdateAddress replaces an address. Orders already shipped to it keep the
+// copy they were placed with. The address stays the default unless
+// is_default is set to false, and then the most recently added other address
+// becomes the default; the user's only address stays their default.
+func UpdateAddress(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	address, ok := findAddressParam(c, userID.(int))
+	if !ok {
+		return
+	}
+
+	var input addressInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	wasDefault := address.IsDefault
+	address.PostalAddress = normalizeAddress(input.PostalAddress)
+	if input.IsDefault != nil {
+		address.IsDefault = *input.IsDefault
+	}
+	if msg := validateAddress(address.PostalAddress); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if wasDefault && !address.IsDefault {
+			promoted, err := promoteNextAddress(tx, address.UserID, address.ID)
+			if err != nil {
+				return err
+			}
+			address.IsDefault = !promoted
+		}
+
+		if err := tx.Save(&address).Error; err != nil {
+			return err
+		}
+		if address.IsDefault {
+			return setDefaultAddress(tx, address.UserID, address.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating address"})
+		return
+	}
+
+	c.JSON(http.StatusOK, address)
+}
+
+func SetDefaultAddress(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	address, ok := findAddressParam(c, userID.(int))
+	if !ok {
+		return
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		return setDefaultAddress(tx, address.UserID, address.ID)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating address"})
+		return
+	}
+	address.IsDefault = true
+
+	c.JSON(http.StatusOK, address)
+}
+
+// DeleteAddress removes an address from the book. If it was the default, the
+// most recently added remaining address becomes the default.
+func DeleteAddress(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	address, ok := findAddressParam(c, userID.(int))
+	if !ok {
+		return
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&address).Error; err != nil {
+			return err
+		}
+		if !address.IsDefault {
+			return nil
+		}
+		_, err := promoteNextAddress(tx, address.UserID, address.ID)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting address"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Address deleted successfully"})
+}
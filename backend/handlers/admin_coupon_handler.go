@@ -0,0 +1,285 @@
+package handlers
+
+import (
+	"net/http"
+	"regexp"
+	"shopping-cart/config"
+	"shopping-cart/models"
+	"shopping-cart/money"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var couponCodePattern = regexp.MustCompile(`^[A-Z0-9_-]{3,32}$`)
+
+type couponInput struct {
+	Code         *string      `json:"code"`
+	Type         *string      `json:"type"`
+	PercentOff   *int         `json:"percent_off"`
+	AmountOff    *money.Money `json:"amount_off"`
+	BuyQuantity  *int         `json:"buy_quantity"`
+	GetQuantity  *int         `json:"get_quantity"`
+	Category     *string      `json:"category"`
+	Brand        *string      `json:"brand"`
+	MinSpend     *money.Money `json:"min_spend"`
+	StartsAt     *time.Time   `json:"starts_at"`
+	EndsAt       *time.Time   `json:"ends_at"`
+	UsageLimit   *int         `json:"usage_limit"`
+	PerUserLimit *int         `json:"per_user_limit"`
+	Active       *bool        `json:"active"`
+}
+
+// applyTo copies the fields present in the input onto coupon.
+func (input couponInput) applyTo(coupon *models.Coupon) {
+	if input.Code != nil {
+		coupon.Code = models.NormalizeCouponCode(*input.Code)
+	}
+	if input.Type != nil {
+		coupon.Type = *input.Type
+	}
+	if input.PercentOff != nil {
+		coupon.PercentOff = *input.PercentOff
+	}
+	if input.AmountOff != nil {
+		coupon.AmountOff = *input.AmountOff
+	}
+	if input.BuyQuantity != nil {
+		coupon.BuyQuantity = *input.BuyQuantity
+	}
+	if input.GetQuantity != nil {
+		coupon.GetQuantity = *input.GetQuantity
+	}
+	if input.Category != nil {
+		coupon.Category = *input.Category
+	}
+	if input.Brand != nil {
+		coupon.Brand = strings.TrimSpace(*input.Brand)
+	}
+	if input.MinSpend != nil {
+		coupon.MinSpend = *input.MinSpend
+	}
+	if input.StartsAt != nil {
+		coupon.StartsAt = input.StartsAt
+	}
+	if input.EndsAt != nil {
+		coupon.EndsAt = input.EndsAt
+	}
+	if input.UsageLimit != nil {
+		coupon.UsageLimit = *input.UsageLimit
+	}
+	if input.PerUserLimit != nil {
+		coupon.PerUserLimit = *input.PerUserLimit
+	}
+	if input.Active != nil {
+		coupon.Active = *input.Active
+	}
+}
+
+// validateCoupon returns a message describing the first invalid field, or an
+// empty string if the coupon is valid.
+func validateCoupon(coupon models.Coupon) string {
+	if !couponCodePattern.MatchString(coupon.Code) {
+		return "Code must be 3 to 32 letters, digits, dashes or underscores"
+	}
+	if !models.ValidCouponType(coupon.Type) {
+		return "Unknown type, must be one of: " + strings.Join(models.CouponTypes, ", ")
+	}
+
+	switch coupon.Type {
+	case models.CouponPercentOff:
+		if coupon.PercentOff < 1 || coupon.PercentOff > 100 {
+			return "percent_off must be between 1 and 100"
+		}
+	case models.CouponAmountOff:
+		if !coupon.AmountOff.IsPositive() {
+			return "amount_off must be greater than zero"
+		}
+		if coupon.AmountOff.Currency != money.DefaultCurrency {
+			return "amount_off must be in " + money.DefaultCurrency
+		}
+	case models.CouponBuyXGetY:
+		if coupon.BuyQuantity < 1 || coupon.GetQuantity < 1 {
+			return "buy_quantity and get_quantity must be at least 1"
+		}
+	}
+
+	if coupon.MinSpend.Amount < 0 {
+		return "min_spend cannot be negative"
+	}
+	if coupon.MinSpend.Currency != money.DefaultCurrency {
+		return "min_spend must be in " + money.DefaultCurrency
+	}
+	if coupon.Category != "" && !models.ValidCategory(coupon.Category) {
+		return "Unknown category, must be one of: " + strings.Join(models.ItemCategories, ", ")
+	}
+	if coupon.StartsAt != nil && coupon.EndsAt != nil && !coupon.EndsAt.After(*coupon.StartsAt) {
+		return "ends_at must be after starts_at"
+	}
+	if coupon.UsageLimit < 0 || coupon.PerUserLimit < 0 {
+		return "Usage limits cannot be negative"
+	}
+	return ""
+}
+
+// couponCodeTaken reports whether another coupon already uses coupon's code.
+func couponCodeTaken(coupon models.Coupon) (bool, error) {
+	var count int
+	err := config.DB.Model(&models.Coupon{}).
+		Where("code = ? AND id <> ?", coupon.Code, coupon.ID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func findCouponParam(c *gin.Context) (models.Coupon, bool) {
+	var coupon models.Coupon
+	couponID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid coupon ID"})
+		return coupon, false
+	}
+
+	if err := config.DB.First(&coupon, couponID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Coupon not found"})
+		return coupon, false
+	}
+	return coupon, true
+}
+
+func ListCoupons(c *gin.Context) {
+	var coupons []models.Coupon
+	if err := config.DB.Order("id").Find(&coupons).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching coupons"})
+		return
+	}
+	if coupons == nil {
+		coupons = []models.Coupon{}
+	}
+
+	c.JSON(http.StatusOK, coupons)
+}
+
+func GetCoupon(c *gin.Context) {
+	coupon, ok := findCouponParam(c)
+	if !ok {
+		return
+	}
+
+	var redemptions []models.CouponRedemption
+	if err := config.DB.Where("coupon_id = ?", coupon.ID).Order("id").Find(&redemptions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching redemptions"})
+		return
+	}
+	if redemptions == nil {
+		redemptions = []models.CouponRedemption{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"coupon":      coupon,
+		"redemptions": redemptions,
+	})
+}
+
+func CreateCoupon(c *gin.Context) {
+	var input couponInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	coupon := models.Coupon{
+		Active:    true,
+		AmountOff: money.Zero(money.DefaultCurrency),
+		MinSpend:  money.Zero(money.DefaultCurrency),
+	}
+	input.applyTo(&coupon)
+	if msg := validateCoupon(coupon); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	taken, err := couponCodeTaken(coupon)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating coupon"})
+		return
+	}
+	if taken {
+		c.JSON(http.StatusConflict, gin.H{"error": "Coupon code already exists"})
+		return
+	}
+
+	if err := config.DB.Create(&coupon).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating coupon"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, coupon)
+}
+
+// UpdateCoupon changes the fields present in the body. The redemption count
+// is kept as it is.
+func UpdateCoupon(c *gin.Context) {
+	coupon, ok := findCouponParam(c)
+	if !ok {
+		return
+	}
+
+	var input couponInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	input.applyTo(&coupon)
+	if msg := validateCoupon(coupon); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	taken, err := couponCodeTaken(coupon)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating coupon"})
+		return
+	}
+	if taken {
+		c.JSON(http.StatusConflict, gin.H{"error": "Coupon code already exists"})
+		return
+	}
+
+	// The redemption count only changes through checkout and cancellation
+	if err := config.DB.Omit("times_redeemed").Save(&coupon).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating coupon"})
+		return
+	}
+
+	c.JSON(http.StatusOK, coupon)
+}
+
+func DeleteCoupon(c *gin.Context) {
+	coupon, ok := findCouponParam(c)
+	if !ok {
+		return
+	}
+
+	// Redemptions are the record of which orders used the coupon
+	var redemptions int
+	if err := config.DB.Model(&models.CouponRedemption{}).Where("coupon_id = ?", coupon.ID).Count(&redemptions).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking coupon redemptions"})
+		return
+	}
+	if redemptions > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Coupon has been redeemed, deactivate it instead"})
+		return
+	}
+
+	if err := config.DB.Delete(&coupon).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting coupon"})
+		return
+	}
+	// Carts holding the coupon go back to having none
+	config.DB.Model(&models.Cart{}).Where("coupon_id = ?", coupon.ID).Update("coupon_id", 0)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Coupon deleted successfully"})
+}
@@ -0,0 +1,355 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"shopping-cart/config"
+	"shopping-cart/models"
+	"shopping-cart/money"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+type itemInput struct {
+	Name        *string      `json:"name"`
+	Status      *string      `json:"status"`
+	Description *string      `json:"description"`
+	Price       *money.Money `json:"price"`
+	Category    *string      `json:"category"`
+	Brand       *string      `json:"brand"`
+	ImageURLs   *string      `json:"image_urls"`
+	WeightGrams *int         `json:"weight_grams"`
+	LengthMM    *int         `json:"length_mm"`
+	WidthMM     *int         `json:"width_mm"`
+	HeightMM    *int         `json:"height_mm"`
+}
+
+// applyTo copies the fields present in the input onto item.
+func (input itemInput) applyTo(item *models.Item) {
+	if input.Name != nil {
+		item.Name = strings.TrimSpace(*input.Name)
+	}
+	if input.Status != nil {
+		item.Status = *input.Status
+	}
+	if input.Description != nil {
+		item.Description = *input.Description
+	}
+	if input.Price != nil {
+		item.Price = *input.Price
+	}
+	if input.Category != nil {
+		item.Category = *input.Category
+	}
+	if input.Brand != nil {
+		item.Brand = *input.Brand
+	}
+	if input.ImageURLs != nil {
+		item.ImageURLs = *input.ImageURLs
+	}
+	if input.WeightGrams != nil {
+		item.WeightGrams = *input.WeightGrams
+	}
+	if input.LengthMM != nil {
+		item.LengthMM = *input.LengthMM
+	}
+	if input.WidthMM != nil {
+		item.WidthMM = *input.WidthMM
+	}
+	if input.HeightMM != nil {
+		item.HeightMM = *input.HeightMM
+	}
+}
+
+// validateItem returns a message describing the first invalid field, or an
+// empty string if the item is valid.
+func validateItem(item models.Item) string {
+	if item.Name == "" {
+		return "Name is required"
+	}
+	if !item.Price.IsPositive() {
+		return "Price must be greater than zero"
+	}
+	if item.Price.Currency != money.DefaultCurrency {
+		return "Price must be in " + money.DefaultCurrency
+	}
+	if !models.ValidCategory(item.Category) {
+		return "Unknown category, must be one of: " + strings.Join(models.ItemCategories, ", ")
+	}
+	if !models.ValidItemStatus(item.Status) {
+		return "Status must be active or inactive"
+	}
+	if item.WeightGrams < 0 || item.LengthMM < 0 || item.WidthMM < 0 || item.HeightMM < 0 {
+		return "Weight and dimensions cannot be negative"
+	}
+	return ""
+}
+
+// syncSearchIndex pushes an item change to the search index. The item row is
+// already saved at this point, so a failure is logged rather than returned;
+// the index is rebuilt from the table on the next start.
+func syncSearchIndex(item models.Item) {
+	if err := config.Search.Index(item); err != nil {
+		log.Printf("Error indexing item %d: %v", item.ID, err)
+	}
+}
+
+func findItemParam(c *gin.Context) (models.Item, bool) {
+	var item models.Item
+	itemID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item ID"})
+		return item, false
+	}
+
+	if err := config.DB.First(&item, itemID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+		return item, false
+	}
+	return item, true
+}
+
+// CreateItem adds an item with an optional opening stock level. The opening
+// level is recorded as an "initial" stock adjustment so the item's audit
+// trail starts with the item.
+func CreateItem(c *gin.Context) {
+	var input struct {
+		itemInput
+		Stock int `json:"stock"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	item := models.Item{Status: models.ItemStatusActive}
+	input.applyTo(&item)
+	if msg := validateItem(item); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	if input.Stock < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Stock cannot be negative"})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&item).Error; err != nil {
+			return err
+		}
+		adj, err := adjustStock(tx, models.StockAdjustment{
+			ItemID: item.ID,
+			Delta:  input.Stock,
+			Reason: models.StockReasonInitial,
+			UserID: userID.(int),
+		})
+		item.Stock = adj.StockAfter
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating item"})
+		return
+	}
+	syncSearchIndex(item)
+
+	c.JSON(http.StatusCreated, item)
+}
+
+// UpdateItem replaces every editable field of an item; fields missing from
+// the body are cleared and must pass validation like a create.
+func UpdateItem(c *gin.Context) {
+	item, ok := findItemParam(c)
+	if !ok {
+		return
+	}
+
+	var input itemInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	replacement := models.Item{
+		ID:        item.ID,
+		Status:    models.ItemStatusActive,
+		CreatedAt: item.CreatedAt,
+		Stock:     item.Stock,
+	}
+	input.applyTo(&replacement)
+	if msg := validateItem(replacement); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	// Stock only changes through AdjustItemStock and checkout
+	if err := config.DB.Omit("stock").Save(&replacement).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating item"})
+		return
+	}
+	syncSearchIndex(replacement)
+
+	c.JSON(http.StatusOK, replacement)
+}
+
+func PatchItem(c *gin.Context) {
+	item, ok := findItemParam(c)
+	if !ok {
+		return
+	}
+
+	var input itemInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	input.applyTo(&item)
+	if msg := validateItem(item); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	if err := config.DB.Omit("stock").Save(&item).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating item"})
+		return
+	}
+	syncSearchIndex(item)
+
+	c.JSON(http.StatusOK, item)
+}
+
+func ArchiveItem(c *gin.Context) {
+	item, ok := findItemParam(c)
+	if !ok {
+		return
+	}
+
+	if err := config.DB.Model(&item).Update("status", models.ItemStatusInactive).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error archiving item"})
+		return
+	}
+	syncSearchIndex(item)
+
+	c.JSON(http.StatusOK, item)
+}
+
+// DeleteItem deletes an item and takes it out of every cart and wishlist.
+// Orders keep their own snapshot of each line, so order history is
+// unaffected.
+func DeleteItem(c *gin.Context) {
+	item, ok := findItemParam(c)
+	if !ok {
+		return
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("item_id = ?", item.ID).Delete(&models.CartItem{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("item_id = ?", item.ID).Delete(&models.WishlistItem{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&item).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting item"})
+		return
+	}
+	if err := config.Search.Remove(item.ID); err != nil {
+		log.Printf("Error removing item %d from search index: %v", item.ID, err)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Item deleted successfully"})
+}
+
+// ListAllItems returns the whole catalogue, including archived items, with
+// the same paging, filters and sorting as GetItems plus a status filter.
+func ListAllItems(c *gin.Context) {
+	listItems(c, true)
+}
+
+// AdjustItemStock changes an item's stock level, either by a relative delta
+// or to an absolute count, and records the change in the audit trail.
+func AdjustItemStock(c *gin.Context) {
+	item, ok := findItemParam(c)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Delta *int   `json:"delta"`
+		Set   *int   `json:"set"`
+		Note  string `json:"note"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if (input.Delta == nil) == (input.Set == nil) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Provide exactly one of delta or set"})
+		return
+	}
+	if input.Set != nil && *input.Set < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Stock cannot be negative"})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	adj := models.StockAdjustment{
+		ItemID: item.ID,
+		Reason: models.StockReasonAdjustment,
+		Note:   input.Note,
+		UserID: userID.(int),
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if input.Delta != nil {
+			adj.Delta = *input.Delta
+		} else {
+			var current models.Item
+			if err := tx.Select("stock").First(&current, item.ID).Error; err != nil {
+				return err
+			}
+			adj.Delta = *input.Set - current.Stock
+		}
+
+		var err error
+		adj, err = adjustStock(tx, adj)
+		return err
+	})
+	if errors.Is(err, errInsufficientStock) {
+		c.JSON(http.StatusConflict, gin.H{"error": "Adjustment would make stock negative"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error adjusting stock"})
+		return
+	}
+
+	c.JSON(http.StatusOK, adj)
+}
+
+func GetItemStockAdjustments(c *gin.Context) {
+	item, ok := findItemParam(c)
+	if !ok {
+		return
+	}
+
+	adjustments := []models.StockAdjustment{}
+	if err := config.DB.Where("item_id = ?", item.ID).Order("id desc").Find(&adjustments).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching stock adjustments"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"item_id":     item.ID,
+		"stock":       item.Stock,
+		"adjustments": adjustments,
+	})
+}
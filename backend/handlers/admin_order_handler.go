@@ -0,0 +1,183 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"shopping-cart/config"
+	"shopping-cart/models"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+func findOrderParam(c *gin.Context) (models.Order, bool) {
+	var order models.Order
+	orderID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return order, false
+	}
+
+	if err := config.DB.First(&order, orderID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return order, false
+	}
+	return order, true
+}
+
+// adminOrderResponse renders an order with its owner and status history.
+func adminOrderResponse(order models.Order) (gin.H, error) {
+	var lines []models.OrderItem
+	if err := config.DB.Where("order_id = ?", order.ID).Order("id").Find(&lines).Error; err != nil {
+		return nil, err
+	}
+
+	history := []models.OrderStatusChange{}
+	if err := config.DB.Where("order_id = ?", order.ID).Order("id").Find(&history).Error; err != nil {
+		return nil, err
+	}
+
+	payments, err := orderPayments(config.DB, order.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	refunds, err := orderRefunds(config.DB, order.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	response := orderResponse(order, lines)
+	response["user_id"] = order.UserID
+	response["history"] = history
+	response["payments"] = payments
+	response["refunds"] = refunds
+	return response, nil
+}
+
+func ListOrders(c *gin.Context) {
+	params, err := parsePageParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := config.DB.Model(&models.Order{})
+	if status := c.Query("status"); status != "" {
+		if !models.ValidOrderStatus(status) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown order status"})
+			return
+		}
+		query = query.Where("status = ?", status)
+	}
+
+	var total int
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error counting orders"})
+		return
+	}
+
+	var orders []models.Order
+	if err := query.Order("id desc").Offset(params.Offset()).Limit(params.PageSize).Find(&orders).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching orders"})
+		return
+	}
+
+	orderResponses := []gin.H{}
+	for _, order := range orders {
+		var lines []models.OrderItem
+		if err := config.DB.Where("order_id = ?", order.ID).Order("id").Find(&lines).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching order items"})
+			return
+		}
+		response := orderResponse(order, lines)
+		response["user_id"] = order.UserID
+		orderResponses = append(orderResponses, response)
+	}
+
+	c.JSON(http.StatusOK, pageResponse(orderResponses, params, total))
+}
+
+func GetOrder(c *gin.Context) {
+	order, ok := findOrderParam(c)
+	if !ok {
+		return
+	}
+
+	response, err := adminOrderResponse(order)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching order"})
+		return
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+func UpdateOrderStatus(c *gin.Context) {
+	order, ok := findOrderParam(c)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Status string `json:"status" binding:"required"`
+		Note   string `json:"note"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !models.ValidOrderStatus(input.Status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown order status"})
+		return
+	}
+	if input.Status == models.OrderStatusPaid {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Orders become paid when their payment is captured"})
+		return
+	}
+	if input.Status == models.OrderStatusRefunded {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Orders are refunded with POST /admin/orders/:id/refunds"})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if input.Status == models.OrderStatusCancelled {
+			return cancelOrder(tx, &order, userID.(int), input.Note)
+		}
+		return transitionOrder(tx, &order, input.Status, userID.(int), input.Note)
+	})
+
+	var invalid *invalidTransitionError
+	if errors.As(err, &invalid) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":          "Cannot move order from " + invalid.Current + " to " + invalid.Requested,
+			"current_status": invalid.Current,
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating order status"})
+		return
+	}
+
+	// Cancelling a paid order gives the payment back. The refund is recorded
+	// with the order whether or not it goes through
+	var refundErr error
+	if order.Status == models.OrderStatusCancelled {
+		_, refundErr = refundCancelledOrder(order, input.Note, userID.(int))
+	}
+
+	response, err := adminOrderResponse(order)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching order"})
+		return
+	}
+	if refundErr != nil {
+		response["refund_error"] = refundErrorMessage(refundErr)
+	}
+
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,281 @@
+package handlers
+
+import (
+	"net/http"
+	"regexp"
+	"shopping-cart/config"
+	"shopping-cart/models"
+	"shopping-cart/money"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+var shippingCodePattern = regexp.MustCompile(`^[a-z0-9_-]{2,32}$`)
+
+type shippingMethodInput struct {
+	Code           *string                      `json:"code"`
+	Name           *string                      `json:"name"`
+	BaseRate       *money.Money                 `json:"base_rate"`
+	PerKgRate      *money.Money                 `json:"per_kg_rate"`
+	FreeOver       *money.Money                 `json:"free_over"`
+	MaxWeightGrams *int                         `json:"max_weight_grams"`
+	Regions        *string                      `json:"regions"`
+	MinDays        *int                         `json:"min_days"`
+	MaxDays        *int                         `json:"max_days"`
+	Active         *bool                        `json:"active"`
+	RegionRates    *[]models.ShippingRegionRate `json:"region_rates"` // Replaces all of the method's region rates
+}
+
+// normalizeRegions upper-cases a comma-separated region list and drops the
+// blanks and spaces.
+func normalizeRegions(regions string) string {
+	var cleaned []string
+	for _, region := range strings.Split(regions, ",") {
+		if region = strings.ToUpper(strings.TrimSpace(region)); region != "" {
+			cleaned = append(cleaned, region)
+		}
+	}
+	return strings.Join(cleaned, ",")
+}
+
+// applyTo copies the fields present in the input onto method.
+func (input shippingMethodInput) applyTo(method *models.ShippingMethod) {
+	if input.Code != nil {
+		method.Code = strings.ToLower(strings.TrimSpace(*input.Code))
+	}
+	if input.Name != nil {
+		method.Name = strings.TrimSpace(*input.Name)
+	}
+	if input.BaseRate != nil {
+		method.BaseRate = *input.BaseRate
+	}
+	if input.PerKgRate != nil {
+		method.PerKgRate = *input.PerKgRate
+	}
+	if input.FreeOver != nil {
+		method.FreeOver = *input.FreeOver
+	}
+	if input.MaxWeightGrams != nil {
+		method.MaxWeightGrams = *input.MaxWeightGrams
+	}
+	if input.Regions != nil {
+		method.Regions = normalizeRegions(*input.Regions)
+	}
+	if input.MinDays != nil {
+		method.MinDays = *input.MinDays
+	}
+	if input.MaxDays != nil {
+		method.MaxDays = *input.MaxDays
+	}
+	if input.Active != nil {
+		method.Active = *input.Active
+	}
+	if input.RegionRates != nil {
+		method.RegionRates = []models.ShippingRegionRate{}
+		for _, rate := range *input.RegionRates {
+			rate.Region = strings.ToUpper(strings.TrimSpace(rate.Region))
+			method.RegionRates = append(method.RegionRates, rate)
+		}
+	}
+}
+
+// validRate reports whether amount is a usable non-negative rate.
+func validRate(amount money.Money) bool {
+	return amount.Amount >= 0 && amount.Currency == money.DefaultCurrency
+}
+
+// validateShippingMethod returns a message describing the first invalid
+// field, or an empty string if the method is valid.
+func validateShippingMethod(method models.ShippingMethod) string {
+	if !shippingCodePattern.MatchString(method.Code) {
+		return "Code must be 2 to 32 lower case letters, digits, dashes or underscores"
+	}
+	if method.Name == "" {
+		return "Name is required"
+	}
+	if !validRate(method.BaseRate) || !validRate(method.PerKgRate) || !validRate(method.FreeOver) {
+		return "Rates must be non-negative amounts in " + money.DefaultCurrency
+	}
+	if method.MaxWeightGrams < 0 {
+		return "max_weight_grams cannot be negative"
+	}
+	if method.MinDays < 0 || method.MaxDays < method.MinDays {
+		return "Delivery days must satisfy 0 <= min_days <= max_days"
+	}
+
+	seen := map[string]bool{}
+	for _, rate := range method.RegionRates {
+		if rate.Region == "" {
+			return "Each region rate needs a region"
+		}
+		if seen[rate.Region] {
+			return "Duplicate region rate for " + rate.Region
+		}
+		seen[rate.Region] = true
+		if !validRate(rate.BaseRate) || !validRate(rate.PerKgRate) {
+			return "Rates must be non-negative amounts in " + money.DefaultCurrency
+		}
+	}
+	return ""
+}
+
+// saveShippingMethod writes the method and replaces its region rates.
+func saveShippingMethod(tx *gorm.DB, method *models.ShippingMethod) error {
+	if err := tx.Save(method).Error; err != nil {
+		return err
+	}
+	if err := tx.Where("method_id = ?", method.ID).Delete(&models.ShippingRegionRate{}).Error; err != nil {
+		return err
+	}
+	for i := range method.RegionRates {
+		method.RegionRates[i].ID = 0
+		method.RegionRates[i].MethodID = method.ID
+		if err := tx.Create(&method.RegionRates[i]).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func findShippingMethodParam(c *gin.Context) (models.ShippingMethod, bool) {
+	var method models.ShippingMethod
+	methodID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid shipping method ID"})
+		return method, false
+	}
+
+	if err := config.DB.First(&method, methodID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Shipping method not found"})
+		return method, false
+	}
+	if err := loadRegionRates(config.DB, &method); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching shipping method"})
+		return method, false
+	}
+	return method, true
+}
+
+// shippingCodeTaken reports whether another method already uses method's
+// code.
+func shippingCodeTaken(method models.ShippingMethod) (bool, error) {
+	var count int
+	err := config.DB.Model(&models.ShippingMethod{}).
+		Where("code = ? AND id <> ?", method.Code, method.ID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// ListShippingMethods returns every shipping method, including inactive ones.
+func ListShippingMethods(c *gin.Context) {
+	methods, err := loadShippingMethods(config.DB, true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching shipping methods"})
+		return
+	}
+
+	c.JSON(http.StatusOK, methods)
+}
+
+func CreateShippingMethod(c *gin.Context) {
+	var input shippingMethodInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	method := models.ShippingMethod{
+		BaseRate:    money.Zero(money.DefaultCurrency),
+		PerKgRate:   money.Zero(money.DefaultCurrency),
+		FreeOver:    money.Zero(money.DefaultCurrency),
+		Active:      true,
+		RegionRates: []models.ShippingRegionRate{},
+	}
+	input.applyTo(&method)
+	if msg := validateShippingMethod(method); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	taken, err := shippingCodeTaken(method)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating shipping method"})
+		return
+	}
+	if taken {
+		c.JSON(http.StatusConflict, gin.H{"error": "Shipping method code already exists"})
+		return
+	}
+
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		return saveShippingMethod(tx, &method)
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating shipping method"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, method)
+}
+
+// UpdateShippingMethod changes the fields present in the body. Orders keep
+// the shipping charge they were placed with.
+func UpdateShippingMethod(c *gin.Context) {
+	method, ok := findShippingMethodParam(c)
+	if !ok {
+		return
+	}
+
+	var input shippingMethodInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	input.applyTo(&method)
+	if msg := validateShippingMethod(method); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	taken, err := shippingCodeTaken(method)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating shipping method"})
+		return
+	}
+	if taken {
+		c.JSON(http.StatusConflict, gin.H{"error": "Shipping method code already exists"})
+		return
+	}
+
+	if err := config.DB.Transaction(func(tx *gorm.DB) error {
+		return saveShippingMethod(tx, &method)
+	}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating shipping method"})
+		return
+	}
+
+	c.JSON(http.StatusOK, method)
+}
+
+func DeleteShippingMethod(c *gin.Context) {
+	method, ok := findShippingMethodParam(c)
+	if !ok {
+		return
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("method_id = ?", method.ID).Delete(&models.ShippingRegionRate{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&method).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting shipping method"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Shipping method deleted successfully"})
+}
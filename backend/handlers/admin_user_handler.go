@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"net/http"
+	"shopping-cart/auth"
+	"shopping-cart/config"
+	"shopping-cart/models"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+func ListUsers(c *gin.Context) {
+	var users []models.User
+	if err := config.DB.Order("id").Find(&users).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching users"})
+		return
+	}
+
+	userResponses := []gin.H{}
+	for _, user := range users {
+		userResponses = append(userResponses, userResponse(user))
+	}
+
+	c.JSON(http.StatusOK, userResponses)
+}
+
+func UpdateUserRole(c *gin.Context) {
+	targetID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return
+	}
+
+	var input struct {
+		Role string `json:"role" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !models.ValidRole(input.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown role"})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	if targetID == userID.(int) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot change your own role"})
+		return
+	}
+
+	var user models.User
+	if err := config.DB.First(&user, targetID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if err := config.DB.Model(&user).Update("role", input.Role).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating role"})
+		return
+	}
+
+	// Outstanding access tokens still carry the old role, so force a fresh login
+	if err := auth.RevokeAllSessions(user.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error revoking sessions"})
+		return
+	}
+
+	c.JSON(http.StatusOK, userResponse(user))
+}
+
+func userResponse(user models.User) gin.H {
+	return gin.H{
+		"id":         user.ID,
+		"username":   user.Username,
+		"role":       user.Role,
+		"created_at": user.CreatedAt,
+	}
+}
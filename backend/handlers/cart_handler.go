@@ -1,19 +1,92 @@
 package handlers
 
 import (
+	"errors"
 	"net/http"
 	"shopping-cart/config"
 	"shopping-cart/models"
+	"strconv"
+	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
 )
 
-func AddToCart(c *gin.Context) {
-	userID, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
-		return
+// maxCartLineQuantity caps how many units of one item a cart line may hold.
+const maxCartLineQuantity = 20
+
+var errLineLimit = errors.New("cart line limit exceeded")
+
+// Reasons units of an item can't be added to a cart.
+var (
+	errItemNotOnSale  = errors.New("item not found")
+	errMaxPerItem     = errors.New("quantity exceeds the maximum per item")
+	errNotEnoughStock = errors.New("not enough stock available")
+)
+
+// addToCartLine adds quantity units of an item to a cart in one upsert,
+// creating the line if needed. The line is only changed while it stays within
+// limit, so concurrent adds can't push it past stock or the per-line maximum;
+// otherwise errLineLimit is returned. Either way the line's quantity after the
+// call is returned.
+func addToCartLine(db *gorm.DB, cartID, itemID, quantity, limit int) (int, error) {
+	var line models.CartItem
+	if quantity <= limit {
+		result := db.Exec(`INSERT INTO cart_items (cart_id, item_id, quantity) VALUES (?, ?, ?)
+			ON CONFLICT (cart_id, item_id) DO UPDATE SET quantity = cart_items.quantity + excluded.quantity
+			WHERE cart_items.quantity + excluded.quantity <= ?`,
+			cartID, itemID, quantity, limit)
+		if result.Error != nil {
+			return 0, result.Error
+		}
+		if result.RowsAffected > 0 {
+			err := db.Where("cart_id = ? AND item_id = ?", cartID, itemID).First(&line).Error
+			return line.Quantity, err
+		}
+	}
+
+	if err := db.Where("cart_id = ? AND item_id = ?", cartID, itemID).First(&line).Error; err != nil && !gorm.IsRecordNotFoundError(err) {
+		return 0, err
+	}
+	return line.Quantity, errLineLimit
+}
+
+// findItemOnSale loads an item that can be added to a cart, returning
+// errItemNotOnSale if there is no such item or it is off sale.
+func findItemOnSale(db *gorm.DB, itemID int) (models.Item, error) {
+	var item models.Item
+	err := db.Where("status = ?", models.ItemStatusActive).First(&item, itemID).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return item, errItemNotOnSale
+	}
+	return item, err
+}
+
+// addItemToCart adds quantity units of an item on sale to a cart, as long as
+// the whole line stays within the item's stock and maxCartLineQuantity;
+// otherwise errMaxPerItem or errNotEnoughStock is returned. Either way the
+// line's quantity after the call is returned.
+func addItemToCart(db *gorm.DB, cartID int, item models.Item, quantity int) (int, error) {
+	limit := maxCartLineQuantity
+	if item.Stock < limit {
+		limit = item.Stock
+	}
+
+	line, err := addToCartLine(db, cartID, item.ID, quantity, limit)
+	if errors.Is(err, errLineLimit) {
+		// The whole line, not just this addition, has to fit
+		if line+quantity > maxCartLineQuantity {
+			return line, errMaxPerItem
+		}
+		return line, errNotEnoughStock
 	}
+	return line, err
+}
+
+// AddToCart adds units of an item to the shopper's active cart, creating the
+// cart if needed. A guest without a cart is given one and its cart token.
+func AddToCart(c *gin.Context) {
+	owner := requestCartOwner(c)
 
 	var input struct {
 		ItemID   int `json:"item_id" binding:"required"`
@@ -24,181 +97,317 @@ func AddToCart(c *gin.Context) {
 		return
 	}
 
-	// Verify item exists
-	var item models.Item
-	if err := config.DB.First(&item, input.ItemID).Error; err != nil {
+	if input.Quantity < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Quantity must be at least 1"})
+		return
+	}
+
+	// Verify item exists and is on sale
+	item, err := findItemOnSale(config.DB, input.ItemID)
+	if errors.Is(err, errItemNotOnSale) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
 		return
 	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching item"})
+		return
+	}
 
 	// Find or create active cart
-	var cart models.Cart
-	result := config.DB.Where("user_id = ? AND status = ?", userID, "active").First(&cart)
-	if result.Error != nil {
-		// Create new cart
-		cart = models.Cart{
-			UserID: userID.(int),
-			Status: "active",
-			Name:   "Shopping Cart",
-		}
-		if err := config.DB.Create(&cart).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating cart"})
-			return
-		}
+	cart, err := activeCart(config.DB, owner)
+	cartToken := ""
+	if gorm.IsRecordNotFoundError(err) {
+		cart, cartToken, err = createActiveCart(config.DB, owner)
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating cart"})
+		return
+	}
+	if cartToken != "" {
+		setCartToken(c, cartToken)
 	}
 
-	// Check if item already exists in cart
-	var existingCartItem models.CartItem
-	result = config.DB.Where("cart_id = ? AND item_id = ?", cart.ID, input.ItemID).First(&existingCartItem)
-
-	if result.Error == nil {
-		// Item exists, update quantity
-		existingCartItem.Quantity += input.Quantity
-		if err := config.DB.Save(&existingCartItem).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating cart item"})
-			return
-		}
-	} else {
-		// Item doesn't exist, create new cart item
-		cartItem := models.CartItem{
-			CartID:   cart.ID,
-			ItemID:   input.ItemID,
-			Quantity: input.Quantity,
-		}
-
-		if err := config.DB.Create(&cartItem).Error; err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error adding item to cart"})
-			return
-		}
+	quantity, err := addItemToCart(config.DB, cart.ID, item, input.Quantity)
+	if errors.Is(err, errMaxPerItem) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":        "Quantity exceeds the maximum per item",
+			"max_quantity": maxCartLineQuantity,
+		})
+		return
+	}
+	if errors.Is(err, errNotEnoughStock) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":     "Not enough stock available",
+			"available": item.Stock,
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error adding item to cart"})
+		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"message": "Item added to cart successfully",
-		"cart_id": cart.ID,
-		"item":    item,
-	})
+	response := gin.H{
+		"message":  "Item added to cart successfully",
+		"cart_id":  cart.ID,
+		"item":     item,
+		"quantity": quantity,
+	}
+	if cartToken != "" {
+		response["cart_token"] = cartToken
+	}
+	c.JSON(http.StatusOK, response)
 }
 
 func GetUserCart(c *gin.Context) {
-	userID, exists := c.Get("user_id")
-	if !exists {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+	cart, err := activeCart(config.DB, requestCartOwner(c))
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching cart"})
 		return
 	}
-
-	var cart models.Cart
-	result := config.DB.Where("user_id = ? AND status = ?", userID, "active").First(&cart)
-	if result.Error != nil {
+	if err != nil {
 		// Return empty cart if none exists
-		c.JSON(http.StatusOK, gin.H{
-			"id":     0,
-			"status": "empty",
-			"items":  []gin.H{},
-		})
+		totals, err := calculateTotals(nil, config.TaxRegion)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error calculating tax"})
+			return
+		}
+		response := cartResponse(nil, nil, totals)
+		response["unavailable_items"] = []unavailableLine{}
+		response["id"] = 0
+		response["status"] = "empty"
+		c.JSON(http.StatusOK, response)
 		return
 	}
 
-	// Get cart items with their details and quantities, grouped by item_id
-	var cartItems []models.CartItem
-	if err := config.DB.Where("cart_id = ?", cart.ID).Find(&cartItems).Error; err != nil {
+	response, err := cartSummary(config.DB, cart)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching cart items"})
 		return
 	}
+	c.JSON(http.StatusOK, response)
+}
 
-	// Group items by item_id and sum quantities
-	itemQuantities := make(map[int]int)
-	for _, cartItem := range cartItems {
-		itemQuantities[cartItem.ItemID] += cartItem.Quantity
+// unavailableLine is a cart line whose item has been taken off sale. It is
+// shown to the shopper but left out of the cart's totals.
+type unavailableLine struct {
+	ItemID   int    `json:"item_id"`
+	Name     string `json:"name"`
+	Quantity int    `json:"quantity"`
+	Reason   string `json:"reason"`
+}
+
+// loadCartLines prices each line of the cart at its item's current price,
+// returning the items alongside the lines. Lines whose item no longer
+// exists are left out, and lines for archived items are returned apart
+// from the priced lines.
+func loadCartLines(db *gorm.DB, cartID int) ([]models.Item, []models.OrderItem, []unavailableLine, error) {
+	var cartItems []models.CartItem
+	if err := db.Where("cart_id = ?", cartID).Order("item_id").Find(&cartItems).Error; err != nil {
+		return nil, nil, nil, err
 	}
 
-	var itemsWithQuantity []gin.H
-	for itemID, totalQuantity := range itemQuantities {
+	var items []models.Item
+	var lines []models.OrderItem
+	unavailable := []unavailableLine{}
+	for _, cartItem := range cartItems {
 		var item models.Item
-		if err := config.DB.First(&item, itemID).Error; err != nil {
+		if err := db.First(&item, cartItem.ItemID).Error; err != nil {
+			continue
+		}
+		if item.Status != models.ItemStatusActive {
+			unavailable = append(unavailable, unavailableLine{
+				ItemID:   item.ID,
+				Name:     item.Name,
+				Quantity: cartItem.Quantity,
+				Reason:   reasonUnavailable,
+			})
 			continue
 		}
+		items = append(items, item)
+		lines = append(lines, models.NewOrderItem(item, cartItem.Quantity))
+	}
+	return items, lines, unavailable, nil
+}
 
-		itemsWithQuantity = append(itemsWithQuantity, gin.H{
-			"id":          item.ID,
-			"name":        item.Name,
-			"price":       item.Price,
-			"category":    item.Category,
-			"brand":       item.Brand,
-			"description": item.Description,
-			"image_urls":  item.ImageURLs,
-			"quantity":    totalQuantity,
-		})
+// cartSummary renders cart with its lines, applied coupon and totals. A
+// coupon that no longer applies is shown with the reason, and no discount.
+func cartSummary(db *gorm.DB, cart models.Cart) (gin.H, error) {
+	items, lines, unavailable, err := loadCartLines(db, cart.ID)
+	if err != nil {
+		return nil, err
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"id":     cart.ID,
-		"status": cart.Status,
-		"items":  itemsWithQuantity,
-	})
-}
+	applied, err := applyCartCoupon(db, cart, lines)
+	if err != nil {
+		return nil, err
+	}
+	var coupon gin.H
+	if applied != nil {
+		coupon = couponSummary(applied.Coupon, applied.Problem)
+	}
 
-func cleanupDuplicateCartItems(cartID int) error {
-	// Get all cart items for this cart
-	var cartItems []models.CartItem
-	if err := config.DB.Where("cart_id = ?", cartID).Find(&cartItems).Error; err != nil {
-		return err
+	region, err := cartTaxRegion(db, cart.UserID)
+	if err != nil {
+		return nil, err
+	}
+	totals, err := calculateTotals(lines, region)
+	if err != nil {
+		return nil, err
 	}
 
-	// Group by item_id and sum quantities
-	itemQuantities := make(map[int]int)
-	for _, cartItem := range cartItems {
-		itemQuantities[cartItem.ItemID] += cartItem.Quantity
+	response := cartResponse(items, lines, totals)
+	response["unavailable_items"] = unavailable
+	response["tax_region"] = region
+	response["id"] = cart.ID
+	response["name"] = cart.Name
+	response["status"] = cart.Status
+	response["coupon"] = coupon
+	return response, nil
+}
+
+// cartTaxRegion is the region a cart's tax is estimated for before an
+// address is chosen at checkout: the user's default address, or the
+// configured region if they have none.
+func cartTaxRegion(db *gorm.DB, userID int) (string, error) {
+	address, ok, err := defaultAddress(db, userID)
+	if err != nil || !ok {
+		return config.TaxRegion, err
 	}
+	return address.TaxRegion(), nil
+}
 
-	// Delete all existing cart items for this cart
-	if err := config.DB.Where("cart_id = ?", cartID).Delete(&models.CartItem{}).Error; err != nil {
-		return err
+// couponSummary describes the coupon applied to a cart for the shopper.
+func couponSummary(coupon models.Coupon, problem error) gin.H {
+	summary := gin.H{
+		"code":          coupon.Code,
+		"type":          coupon.Type,
+		"valid":         problem == nil,
+		"free_shipping": problem == nil && coupon.Type == models.CouponFreeShipping,
+	}
+	if problem != nil {
+		summary["error"] = problem.Error()
 	}
+	return summary
+}
 
-	// Create new cart items with merged quantities
-	for itemID, totalQuantity := range itemQuantities {
-		cartItem := models.CartItem{
-			CartID:   cartID,
-			ItemID:   itemID,
-			Quantity: totalQuantity,
-		}
-		if err := config.DB.Create(&cartItem).Error; err != nil {
-			return err
-		}
+// cartResponse renders priced cart lines, each next to the item it was
+// priced from, along with the cart totals.
+func cartResponse(items []models.Item, lines []models.OrderItem, totals cartTotals) gin.H {
+	itemsWithQuantity := []gin.H{}
+	for i, line := range lines {
+		item := items[i]
+		itemsWithQuantity = append(itemsWithQuantity, gin.H{
+			"id":           item.ID,
+			"name":         item.Name,
+			"price":        line.UnitPrice,
+			"category":     item.Category,
+			"brand":        item.Brand,
+			"description":  item.Description,
+			"image_urls":   item.ImageURLs,
+			"stock":        item.Stock,
+			"quantity":     line.Quantity,
+			"line_total":   line.LineTotal,
+			"discount":     line.Discount,
+			"tax_rate_bps": line.TaxRate,
+			"tax":          line.Tax,
+		})
 	}
 
-	return nil
+	return gin.H{
+		"items":         itemsWithQuantity,
+		"item_count":    totals.ItemCount,
+		"subtotal":      totals.Subtotal,
+		"discount":      totals.Discount,
+		"tax":           totals.Tax,
+		"tax_inclusive": totals.TaxInclusive,
+		"total":         totals.Total,
+	}
 }
 
-func CleanupCart(c *gin.Context) {
+// ApplyCoupon applies a coupon code to the user's active cart, replacing any
+// coupon already applied.
+func ApplyCoupon(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
 		return
 	}
 
+	var input struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	var cart models.Cart
-	result := config.DB.Where("user_id = ? AND status = ?", userID, "active").First(&cart)
-	if result.Error != nil {
+	if err := config.DB.Where("user_id = ? AND status = ?", userID, models.CartStatusActive).First(&cart).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "No active cart found"})
 		return
 	}
 
-	if err := cleanupDuplicateCartItems(cart.ID); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error cleaning up cart"})
+	_, lines, _, err := loadCartLines(config.DB, cart.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching cart items"})
+		return
+	}
+
+	coupon, err := findCoupon(config.DB, input.Code)
+	if err == nil {
+		err = checkCoupon(config.DB, coupon, cart.UserID, lines, time.Now())
+	}
+	var reason couponError
+	if errors.As(err, &reason) {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": reason.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error applying coupon"})
+		return
+	}
+
+	if err := config.DB.Model(&cart).Update("coupon_id", coupon.ID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error applying coupon"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Cart cleaned up successfully"})
+	response, err := cartSummary(config.DB, cart)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching cart items"})
+		return
+	}
+	c.JSON(http.StatusOK, response)
 }
 
-func DeleteCartItem(c *gin.Context) {
+func RemoveCoupon(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
 		return
 	}
 
+	var cart models.Cart
+	if err := config.DB.Where("user_id = ? AND status = ?", userID, models.CartStatusActive).First(&cart).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No active cart found"})
+		return
+	}
+
+	if err := config.DB.Model(&cart).Update("coupon_id", 0).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error removing coupon"})
+		return
+	}
+
+	response, err := cartSummary(config.DB, cart)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching cart items"})
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func DeleteCartItem(c *gin.Context) {
 	var input struct {
 		ItemID int `json:"item_id" binding:"required"`
 	}
@@ -207,9 +416,9 @@ func DeleteCartItem(c *gin.Context) {
 		return
 	}
 
-	// Get user's active cart
-	var cart models.Cart
-	if err := config.DB.Where("user_id = ? AND status = ?", userID, "active").First(&cart).Error; err != nil {
+	// Get the shopper's active cart
+	cart, err := activeCart(config.DB, requestCartOwner(c))
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "No active cart found"})
 		return
 	}
@@ -222,3 +431,84 @@ func DeleteCartItem(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"message": "Item removed from cart successfully"})
 }
+
+// UpdateCartItem sets the quantity of an item already in the cart. A quantity
+// of zero removes the line.
+func UpdateCartItem(c *gin.Context) {
+	itemID, err := strconv.Atoi(c.Param("item_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item ID"})
+		return
+	}
+
+	var input struct {
+		Quantity *int `json:"quantity" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	quantity := *input.Quantity
+	if quantity < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Quantity cannot be negative"})
+		return
+	}
+	if quantity > maxCartLineQuantity {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":        "Quantity exceeds the maximum per item",
+			"max_quantity": maxCartLineQuantity,
+		})
+		return
+	}
+
+	// Get the shopper's active cart
+	cart, err := activeCart(config.DB, requestCartOwner(c))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No active cart found"})
+		return
+	}
+
+	var line models.CartItem
+	if err := config.DB.Where("cart_id = ? AND item_id = ?", cart.ID, itemID).First(&line).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item not in cart"})
+		return
+	}
+
+	if quantity > 0 {
+		var item models.Item
+		if err := config.DB.Where("status = ?", models.ItemStatusActive).First(&item, itemID).Error; err != nil {
+			c.JSON(http.StatusConflict, gin.H{"error": "Item is no longer available"})
+			return
+		}
+		if quantity > item.Stock {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":     "Not enough stock available",
+				"available": item.Stock,
+			})
+			return
+		}
+	}
+
+	if quantity == 0 {
+		err = config.DB.Delete(&line).Error
+	} else {
+		err = config.DB.Model(&line).Update("quantity", quantity).Error
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating cart item"})
+		return
+	}
+
+	if quantity == 0 {
+		c.JSON(http.StatusOK, gin.H{"message": "Item removed from cart successfully"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":  "Cart item updated successfully",
+		"cart_id":  cart.ID,
+		"item_id":  itemID,
+		"quantity": quantity,
+	})
+}
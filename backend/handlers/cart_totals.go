@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"shopping-cart/config"
+	"shopping-cart/models"
+	"shopping-cart/money"
+	"shopping-cart/tax"
+)
+
+// cartTotals are the amounts for a set of priced lines, calculated the same
+// way for a cart as for the order it becomes.
+type cartTotals struct {
+	ItemCount    int
+	Subtotal     money.Money
+	Discount     money.Money
+	Tax          money.Money
+	Total        money.Money
+	TaxInclusive bool // Tax is part of the subtotal rather than added to it
+}
+
+// calculateTotals has the tax calculator work out each line's tax for
+// region on the line's amount after discount, records the rate and tax on
+// the line, and sums the lines. Tax is added to the total unless prices
+// already include it.
+func calculateTotals(lines []models.OrderItem, region string) (cartTotals, error) {
+	totals := cartTotals{
+		Subtotal:     money.Zero(money.DefaultCurrency),
+		Discount:     money.Zero(money.DefaultCurrency),
+		Tax:          money.Zero(money.DefaultCurrency),
+		TaxInclusive: config.Tax.Inclusive(),
+	}
+
+	taxLines := make([]tax.Line, len(lines))
+	for i, line := range lines {
+		taxLines[i] = tax.Line{Category: line.Category, Amount: line.LineTotal.Sub(line.Discount)}
+	}
+	taxes, err := config.Tax.Calculate(region, taxLines)
+	if err != nil {
+		return totals, err
+	}
+
+	for i, line := range lines {
+		lines[i].TaxRate = taxes[i].RateBasisPoints
+		lines[i].Tax = taxes[i].Amount
+		totals.ItemCount += line.Quantity
+		totals.Subtotal = totals.Subtotal.Add(line.LineTotal)
+		totals.Discount = totals.Discount.Add(line.Discount)
+		totals.Tax = totals.Tax.Add(taxes[i].Amount)
+	}
+	totals.Total = totals.Subtotal.Sub(totals.Discount)
+	if !totals.TaxInclusive {
+		totals.Total = totals.Total.Add(totals.Tax)
+	}
+	return totals, nil
+}
@@ -0,0 +1,354 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"shopping-cart/models"
+	"shopping-cart/money"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+// Checkout steps, reported to the client when one fails.
+const (
+	stepLoadCart     = "load_cart"
+	stepVerifyItems  = "verify_items"
+	stepShipping     = "shipping_address"
+	stepApplyCoupon  = "apply_coupon"
+	stepCalculateTax = "calculate_tax"
+	stepShippingRate = "shipping_method"
+	stepCreateOrder  = "create_order"
+	stepReserveStock = "reserve_stock"
+	stepRedeemCoupon = "redeem_coupon"
+	stepCloseCart    = "close_cart"
+	stepCommit       = "commit"
+)
+
+// checkoutError describes which checkout step failed and how to report it.
+type checkoutError struct {
+	Step    string
+	Status  int
+	Message string
+	Details gin.H
+	Err     error
+}
+
+func (e *checkoutError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%s: %s: %v", e.Step, e.Message, e.Err)
+	}
+	return fmt.Sprintf("%s: %s", e.Step, e.Message)
+}
+
+func (e *checkoutError) Unwrap() error {
+	return e.Err
+}
+
+// response renders the error for the client, naming the failed step.
+func (e *checkoutError) response() gin.H {
+	body := gin.H{"error": e.Message, "step": e.Step}
+	for key, value := range e.Details {
+		body[key] = value
+	}
+	return body
+}
+
+func checkoutFailed(step string, err error) *checkoutError {
+	return &checkoutError{
+		Step:    step,
+		Status:  http.StatusInternalServerError,
+		Message: "Checkout failed",
+		Err:     err,
+	}
+}
+
+// checkoutRequest holds the shopper's choices for an order.
+type checkoutRequest struct {
+	// Address book entry to ship to; the default address if zero
+	AddressID int `json:"address_id"`
+	// Code of the shipping method to deliver by
+	ShippingMethod string `json:"shipping_method"`
+	// Payment source to pay with once the order is placed; the order is
+	// left pending if empty
+	PaymentToken string `json:"payment_token"`
+}
+
+// placeOrder turns the user's active cart into an order within tx. Any
+// returned error is a *checkoutError and the caller must roll tx back.
+func placeOrder(tx *gorm.DB, userID int, req checkoutRequest) (models.Order, []models.OrderItem, error) {
+	var order models.Order
+
+	// Validate the cart
+	var cart models.Cart
+	if err := tx.Where("user_id = ? AND status = ?", userID, models.CartStatusActive).First(&cart).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return order, nil, &checkoutError{Step: stepLoadCart, Status: http.StatusNotFound, Message: "No active cart found"}
+		}
+		return order, nil, checkoutFailed(stepLoadCart, err)
+	}
+
+	var cartItems []models.CartItem
+	if err := tx.Where("cart_id = ?", cart.ID).Find(&cartItems).Error; err != nil {
+		return order, nil, checkoutFailed(stepLoadCart, err)
+	}
+	if len(cartItems) == 0 {
+		return order, nil, &checkoutError{Step: stepLoadCart, Status: http.StatusBadRequest, Message: "Cart is empty"}
+	}
+
+	// Verify every item is still on sale at a valid price and in stock, and
+	// snapshot it at that price
+	var items []models.Item
+	var lines []models.OrderItem
+	for _, cartItem := range cartItems {
+		var item models.Item
+		if err := tx.First(&item, cartItem.ItemID).Error; err != nil {
+			if gorm.IsRecordNotFoundError(err) {
+				return order, nil, unavailableItem(cartItem.ItemID)
+			}
+			return order, nil, checkoutFailed(stepVerifyItems, err)
+		}
+		if item.Status != models.ItemStatusActive || !item.Price.IsPositive() {
+			return order, nil, unavailableItem(item.ID)
+		}
+		if cartItem.Quantity < 1 {
+			return order, nil, &checkoutError{
+				Step:    stepVerifyItems,
+				Status:  http.StatusBadRequest,
+				Message: "Cart line has an invalid quantity",
+				Details: gin.H{"item_id": item.ID},
+			}
+		}
+		if cartItem.Quantity > item.Stock {
+			return order, nil, insufficientStock(item.ID, item.Stock)
+		}
+		items = append(items, item)
+		lines = append(lines, models.NewOrderItem(item, cartItem.Quantity))
+	}
+
+	// Find where the order ships to; the address is copied onto the order so
+	// later edits to the address book don't change it
+	address, err := shippingAddress(tx, userID, req.AddressID)
+	if err != nil {
+		return order, nil, err
+	}
+
+	// Check the coupon still applies now, and discount the lines with it
+	var coupon *models.Coupon
+	if cart.CouponID != 0 {
+		var applied models.Coupon
+		err := tx.First(&applied, cart.CouponID).Error
+		if gorm.IsRecordNotFoundError(err) {
+			// Deleted since it was applied
+			return order, nil, couponRejected(stepApplyCoupon, applied, errCouponInvalid)
+		}
+		if err != nil {
+			return order, nil, checkoutFailed(stepApplyCoupon, err)
+		}
+		if err := checkCoupon(tx, applied, userID, lines, time.Now()); err != nil {
+			return order, nil, couponRejected(stepApplyCoupon, applied, err)
+		}
+		applyCoupon(applied, lines)
+		coupon = &applied
+	}
+
+	region := address.TaxRegion()
+	totals, err := calculateTotals(lines, region)
+	if err != nil {
+		return order, nil, checkoutFailed(stepCalculateTax, err)
+	}
+
+	// Price delivery by the chosen method
+	freeShipping := coupon != nil && coupon.Type == models.CouponFreeShipping
+	method, shipping, err := shippingCharge(tx, req.ShippingMethod, region, chargeableWeight(items, lines), totals.Subtotal.Sub(totals.Discount), freeShipping)
+	if err != nil {
+		return order, nil, err
+	}
+
+	// Create the order and its lines
+	order = models.Order{
+		UserID:       userID,
+		CartID:       cart.ID,
+		Status:       models.OrderStatusPending,
+		Subtotal:     totals.Subtotal,
+		Tax:          totals.Tax,
+		Discount:     totals.Discount,
+		Total:        totals.Total.Add(shipping),
+		TaxRegion:    region,
+		TaxInclusive: totals.TaxInclusive,
+
+		ShippingAddressID: address.ID,
+		ShippingAddress:   address.PostalAddress,
+		ShippingMethod:    method.Code,
+		Shipping:          shipping,
+	}
+	if coupon != nil {
+		order.CouponCode = coupon.Code
+	}
+	if err := tx.Create(&order).Error; err != nil {
+		return order, nil, checkoutFailed(stepCreateOrder, err)
+	}
+	if err := tx.Create(&models.OrderStatusChange{
+		OrderID:   order.ID,
+		ToStatus:  order.Status,
+		ChangedBy: userID,
+	}).Error; err != nil {
+		return order, nil, checkoutFailed(stepCreateOrder, err)
+	}
+	for i := range lines {
+		lines[i].OrderID = order.ID
+		if err := tx.Create(&lines[i]).Error; err != nil {
+			return order, nil, checkoutFailed(stepCreateOrder, err)
+		}
+	}
+
+	// Take the stock; the conditional decrement catches a concurrent checkout
+	// that got to the last units first
+	for _, line := range lines {
+		_, err := adjustStock(tx, models.StockAdjustment{
+			ItemID:  line.ItemID,
+			Delta:   -line.Quantity,
+			Reason:  models.StockReasonOrder,
+			UserID:  userID,
+			OrderID: order.ID,
+		})
+		if errors.Is(err, errInsufficientStock) {
+			return order, nil, insufficientStock(line.ItemID, -1)
+		}
+		if err != nil {
+			return order, nil, checkoutFailed(stepReserveStock, err)
+		}
+	}
+
+	// Count the coupon's use; the conditional increment stops concurrent
+	// checkouts from going over its usage limit
+	if coupon != nil {
+		if err := redeemCoupon(tx, *coupon, order); err != nil {
+			return order, nil, couponRejected(stepRedeemCoupon, *coupon, err)
+		}
+	}
+
+	// Close the cart, unless a concurrent checkout already did
+	result := tx.Model(&models.Cart{}).
+		Where("id = ? AND status = ?", cart.ID, models.CartStatusActive).
+		Update("status", models.CartStatusOrdered)
+	if result.Error != nil {
+		return order, nil, checkoutFailed(stepCloseCart, result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return order, nil, &checkoutError{Step: stepCloseCart, Status: http.StatusConflict, Message: "Cart has already been checked out"}
+	}
+
+	return order, lines, nil
+}
+
+// shippingAddress loads the user's address to ship to, or their default
+// address if addressID is zero, and checks it can still be shipped to.
+func shippingAddress(tx *gorm.DB, userID, addressID int) (models.Address, error) {
+	var address models.Address
+	if addressID == 0 {
+		found, ok, err := defaultAddress(tx, userID)
+		if err != nil {
+			return address, checkoutFailed(stepShipping, err)
+		}
+		if !ok {
+			return address, &checkoutError{Step: stepShipping, Status: http.StatusBadRequest, Message: "A shipping address is required"}
+		}
+		address = found
+	} else if err := tx.Where("id = ? AND user_id = ?", addressID, userID).First(&address).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return address, &checkoutError{
+				Step:    stepShipping,
+				Status:  http.StatusNotFound,
+				Message: "Shipping address not found",
+				Details: gin.H{"address_id": addressID},
+			}
+		}
+		return address, checkoutFailed(stepShipping, err)
+	}
+
+	if msg := validateAddress(address.PostalAddress); msg != "" {
+		return address, &checkoutError{
+			Step:    stepShipping,
+			Status:  http.StatusBadRequest,
+			Message: msg,
+			Details: gin.H{"address_id": address.ID},
+		}
+	}
+	return address, nil
+}
+
+// shippingCharge looks up the shipping method by code and prices the order's
+// delivery with it.
+func shippingCharge(tx *gorm.DB, code, region string, weightGrams int, value money.Money, freeShipping bool) (models.ShippingMethod, money.Money, error) {
+	var method models.ShippingMethod
+	if code == "" {
+		return method, money.Money{}, &checkoutError{Step: stepShippingRate, Status: http.StatusBadRequest, Message: "A shipping method is required"}
+	}
+	if err := tx.Where("code = ? AND active = ?", code, true).First(&method).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return method, money.Money{}, &checkoutError{
+				Step:    stepShippingRate,
+				Status:  http.StatusBadRequest,
+				Message: "Unknown shipping method",
+				Details: gin.H{"shipping_method": code},
+			}
+		}
+		return method, money.Money{}, checkoutFailed(stepShippingRate, err)
+	}
+	if err := loadRegionRates(tx, &method); err != nil {
+		return method, money.Money{}, checkoutFailed(stepShippingRate, err)
+	}
+
+	cost, ok := quoteShipping(method, region, weightGrams, value, freeShipping)
+	if !ok {
+		return method, money.Money{}, &checkoutError{
+			Step:    stepShippingRate,
+			Status:  http.StatusBadRequest,
+			Message: "Shipping method isn't available for this address and cart",
+			Details: gin.H{"shipping_method": code},
+		}
+	}
+	return method, cost, nil
+}
+
+// couponRejected reports a coupon that can't be used, or the error that
+// stopped it being checked.
+func couponRejected(step string, coupon models.Coupon, err error) *checkoutError {
+	var reason couponError
+	if !errors.As(err, &reason) {
+		return checkoutFailed(step, err)
+	}
+	return &checkoutError{
+		Step:    step,
+		Status:  http.StatusConflict,
+		Message: reason.Error(),
+		Details: gin.H{"coupon_code": coupon.Code},
+	}
+}
+
+func unavailableItem(itemID int) *checkoutError {
+	return &checkoutError{
+		Step:    stepVerifyItems,
+		Status:  http.StatusConflict,
+		Message: "Item is no longer available",
+		Details: gin.H{"item_id": itemID},
+	}
+}
+
+// insufficientStock reports a line that can't be fulfilled; available is
+// omitted when negative because it isn't known.
+func insufficientStock(itemID, available int) *checkoutError {
+	details := gin.H{"item_id": itemID}
+	if available >= 0 {
+		details["available"] = available
+	}
+	return &checkoutError{
+		Step:    stepReserveStock,
+		Status:  http.StatusConflict,
+		Message: "Not enough stock available",
+		Details: details,
+	}
+}
@@ -0,0 +1,341 @@
+package handlers
+
+import (
+	"net/http"
+	"shopping-cart/auth"
+	"shopping-cart/config"
+	"shopping-cart/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+// cartOwner is whoever a cart request acts for: a signed-in user, or a
+// guest identified by their cart token.
+type cartOwner struct {
+	UserID int    // 0 for a guest
+	Token  string // The guest's cart token, if they sent one
+}
+
+func (o cartOwner) guest() bool {
+	return o.UserID == 0
+}
+
+// cartTokenFromRequest returns the guest cart token the request carries.
+func cartTokenFromRequest(c *gin.Context) string {
+	if token := c.GetHeader(auth.CartTokenHeader); token != "" {
+		return token
+	}
+	token, _ := c.Cookie(auth.CartTokenCookie)
+	return token
+}
+
+// requestCartOwner identifies whose cart the request is for. It must run
+// after AuthMiddleware or OptionalAuth.
+func requestCartOwner(c *gin.Context) cartOwner {
+	if userID, exists := c.Get("user_id"); exists {
+		return cartOwner{UserID: userID.(int)}
+	}
+	return cartOwner{Token: cartTokenFromRequest(c)}
+}
+
+// activeCart finds the owner's active cart, returning a record not found
+// error if they have none. Using a guest cart extends its life.
+func activeCart(db *gorm.DB, owner cartOwner) (models.Cart, error) {
+	var cart models.Cart
+	if !owner.guest() {
+		err := db.Where("user_id = ? AND status = ?", owner.UserID, models.CartStatusActive).First(&cart).Error
+		return cart, err
+	}
+	if owner.Token == "" {
+		return cart, gorm.ErrRecordNotFound
+	}
+
+	now := time.Now()
+	err := db.Where("token_hash = ? AND user_id = 0 AND status = ? AND expires_at > ?",
+		auth.HashCartToken(owner.Token), models.CartStatusActive, now).First(&cart).Error
+	if err != nil {
+		return cart, err
+	}
+
+	expiresAt := now.Add(config.GuestCartTTL)
+	cart.ExpiresAt = &expiresAt
+	return cart, db.Model(&cart).Update("expires_at", expiresAt).Error
+}
+
+// createActiveCart starts an active cart for the owner. A user's cart is
+// named so it doesn't clash with their other carts. A guest's cart gets a
+// new cart token, which is returned; it is the only way back to the cart.
+func createActiveCart(db *gorm.DB, owner cartOwner) (models.Cart, string, error) {
+	cart := models.Cart{
+		UserID: owner.UserID,
+		Status: models.CartStatusActive,
+		Name:   defaultCartName,
+	}
+	if !owner.guest() {
+		name, err := unusedDefaultCartName(db, owner.UserID)
+		if err != nil {
+			return cart, "", err
+		}
+		cart.Name = name
+		return cart, "", db.Create(&cart).Error
+	}
+
+	if err := expireGuestCarts(db); err != nil {
+		return cart, "", err
+	}
+
+	token, hash, err := auth.NewCartToken()
+	if err != nil {
+		return cart, "", err
+	}
+	expiresAt := time.Now().Add(config.GuestCartTTL)
+	cart.TokenHash = hash
+	cart.ExpiresAt = &expiresAt
+	return cart, token, db.Create(&cart).Error
+}
+
+// expireGuestCarts deletes guest carts that haven't been used within
+// config.GuestCartTTL, with their lines.
+func expireGuestCarts(db *gorm.DB) error {
+	expired := db.Model(&models.Cart{}).
+		Select("id").
+		Where("user_id = 0 AND token_hash <> '' AND expires_at <= ?", time.Now()).
+		SubQuery()
+	if err := db.Where("cart_id IN ?", expired).Delete(&models.CartItem{}).Error; err != nil {
+		return err
+	}
+	return db.Where("user_id = 0 AND token_hash <> '' AND expires_at <= ?", time.Now()).Delete(&models.Cart{}).Error
+}
+
+// setCartToken hands a new guest cart token to the client, in both the
+// response header and a cookie.
+func setCartToken(c *gin.Context, token string) {
+	c.Header(auth.CartTokenHeader, token)
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(auth.CartTokenCookie, token, int(config.GuestCartTTL.Seconds()), "/", "", false, true)
+}
+
+// clearCartToken removes the guest cart token cookie once the cart has been
+// merged into a user's.
+func clearCartToken(c *gin.Context) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(auth.CartTokenCookie, "", -1, "/", "", false, true)
+}
+
+// mergeGuestCartOnLogin merges the guest cart for token into the user's
+// active cart by config.CartMergeStrategy. It returns nil if the token has
+// no live cart.
+func mergeGuestCartOnLogin(token string, userID int) (*cartCopyResult, error) {
+	var result cartCopyResult
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		guest, err := activeCart(tx, cartOwner{Token: token})
+		if err != nil {
+			return err
+		}
+		result, err = mergeGuestCart(tx, guest, userID, config.CartMergeStrategy)
+		return err
+	})
+	if gorm.IsRecordNotFoundError(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// lineOutcome reports what happened to one line copied into a cart.
+type lineOutcome struct {
+	ItemID    int    `json:"item_id"`
+	Requested int    `json:"requested"`        // Units asked for
+	Quantity  int    `json:"quantity"`         // Units of the item now in the cart
+	Reason    string `json:"reason,omitempty"` // Why fewer units than asked for were added
+}
+
+// cartCopyResult reports how lines were copied into a cart: lines added as
+// asked, lines added with fewer units, and lines left out.
+type cartCopyResult struct {
+	CartID   int           `json:"cart_id"`
+	Added    []lineOutcome `json:"added"`
+	Adjusted []lineOutcome `json:"adjusted"`
+	Skipped  []lineOutcome `json:"skipped"`
+}
+
+func newCartCopyResult(cartID int) cartCopyResult {
+	return cartCopyResult{
+		CartID:   cartID,
+		Added:    []lineOutcome{},
+		Adjusted: []lineOutcome{},
+		Skipped:  []lineOutcome{},
+	}
+}
+
+// Reasons a copied line was adjusted or skipped.
+const (
+	reasonUnavailable = "Item is no longer available"
+	reasonOutOfStock  = "Item is out of stock"
+	reasonStockLimit  = "Limited to the stock available"
+	reasonLineLimit   = "Limited to the maximum per item"
+	reasonCartHolds   = "Cart already holds the available stock"
+)
+
+// mergedQuantity is how many units of an item the user's cart should hold
+// after merging, when the user cart has current units and the guest cart
+// guest units.
+func mergedQuantity(strategy string, current, guest int) int {
+	switch strategy {
+	case config.CartMergeMax:
+		if current > guest {
+			return current
+		}
+		return guest
+	case config.CartMergeUser:
+		if current > 0 {
+			return current
+		}
+		return guest
+	default:
+		return current + guest
+	}
+}
+
+// fitCartLine works out how many units of an item a cart line can hold when
+// wanted units are asked for, keeping within stock and the per-line maximum
+// but never dropping below the kept units the line already has. The reason
+// is empty if every wanted unit fits; a missing or archived item keeps only
+// the kept units.
+func fitCartLine(tx *gorm.DB, itemID, wanted, kept int) (int, string, error) {
+	var item models.Item
+	if err := tx.Where("status = ?", models.ItemStatusActive).First(&item, itemID).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return kept, reasonUnavailable, nil
+		}
+		return 0, "", err
+	}
+
+	limit, limitReason := maxCartLineQuantity, reasonLineLimit
+	if item.Stock < limit {
+		limit, limitReason = item.Stock, reasonStockLimit
+	}
+	quantity, reason := wanted, ""
+	if quantity > limit {
+		quantity, reason = limit, limitReason
+	}
+	if quantity < kept {
+		quantity = kept
+	}
+	if quantity == 0 {
+		reason = reasonOutOfStock
+	}
+	return quantity, reason, nil
+}
+
+// mergeGuestCart moves a guest's cart into the user's active cart within tx,
+// combining lines for the same item by strategy and keeping each line within
+// stock and the per-line maximum. If the user has no active cart the guest
+// cart becomes theirs, with its lines held to the same limits. The guest
+// cart's token stops working either way.
+func mergeGuestCart(tx *gorm.DB, guest models.Cart, userID int, strategy string) (cartCopyResult, error) {
+	var guestLines []models.CartItem
+	if err := tx.Where("cart_id = ?", guest.ID).Order("item_id").Find(&guestLines).Error; err != nil {
+		return cartCopyResult{}, err
+	}
+
+	cart, err := activeCart(tx, cartOwner{UserID: userID})
+	if gorm.IsRecordNotFoundError(err) {
+		return adoptGuestCart(tx, guest, guestLines, userID)
+	}
+	if err != nil {
+		return cartCopyResult{}, err
+	}
+
+	result := newCartCopyResult(cart.ID)
+	for _, line := range guestLines {
+		outcome := lineOutcome{ItemID: line.ItemID, Requested: line.Quantity}
+
+		var current models.CartItem
+		err := tx.Where("cart_id = ? AND item_id = ?", cart.ID, line.ItemID).First(&current).Error
+		if err != nil && !gorm.IsRecordNotFoundError(err) {
+			return result, err
+		}
+
+		// Never take away units the user already had
+		wanted := mergedQuantity(strategy, current.Quantity, line.Quantity)
+		quantity, reason, err := fitCartLine(tx, line.ItemID, wanted, current.Quantity)
+		if err != nil {
+			return result, err
+		}
+		outcome.Quantity = quantity
+		outcome.Reason = reason
+
+		switch {
+		case reason == reasonUnavailable || quantity == 0:
+			result.Skipped = append(result.Skipped, outcome)
+			continue
+		case current.Quantity == 0:
+			err = tx.Create(&models.CartItem{CartID: cart.ID, ItemID: line.ItemID, Quantity: quantity}).Error
+		default:
+			err = tx.Model(&current).Update("quantity", quantity).Error
+		}
+		if err != nil {
+			return result, err
+		}
+
+		if outcome.Reason != "" {
+			result.Adjusted = append(result.Adjusted, outcome)
+		} else {
+			result.Added = append(result.Added, outcome)
+		}
+	}
+
+	if err := tx.Where("cart_id = ?", guest.ID).Delete(&models.CartItem{}).Error; err != nil {
+		return result, err
+	}
+	return result, tx.Delete(&guest).Error
+}
+
+// adoptGuestCart makes the guest cart the user's active cart within tx,
+// named so it doesn't clash with their other carts. Its lines are checked
+// like merged ones: lines for unavailable or out of stock items are removed,
+// and the rest are held to stock and the per-line maximum.
+func adoptGuestCart(tx *gorm.DB, guest models.Cart, lines []models.CartItem, userID int) (cartCopyResult, error) {
+	result := newCartCopyResult(guest.ID)
+	for _, line := range lines {
+		outcome := lineOutcome{ItemID: line.ItemID, Requested: line.Quantity}
+
+		quantity, reason, err := fitCartLine(tx, line.ItemID, line.Quantity, 0)
+		if err != nil {
+			return result, err
+		}
+		outcome.Quantity = quantity
+		outcome.Reason = reason
+
+		switch {
+		case quantity == 0:
+			err = tx.Where("cart_id = ? AND item_id = ?", guest.ID, line.ItemID).Delete(&models.CartItem{}).Error
+			result.Skipped = append(result.Skipped, outcome)
+		case reason != "":
+			err = tx.Model(&line).Update("quantity", quantity).Error
+			result.Adjusted = append(result.Adjusted, outcome)
+		default:
+			result.Added = append(result.Added, outcome)
+		}
+		if err != nil {
+			return result, err
+		}
+	}
+
+	name, err := unusedDefaultCartName(tx, userID)
+	if err != nil {
+		return result, err
+	}
+	err = tx.Model(&guest).Updates(map[string]interface{}{
+		"user_id":    userID,
+		"name":       name,
+		"token_hash": "",
+		"expires_at": gorm.Expr("NULL"),
+	}).Error
+	return result, err
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"errors"
+	"shopping-cart/models"
+
+	"github.com/jinzhu/gorm"
+)
+
+var errInsufficientStock = errors.New("insufficient stock")
+
+// adjustStock applies adj.Delta to the item's stock within tx and records the
+// adjustment. The update is a single conditional statement, so concurrent
+// decrements can never take stock below zero; when there is not enough stock
+// errInsufficientStock is returned and nothing is changed.
+func adjustStock(tx *gorm.DB, adj models.StockAdjustment) (models.StockAdjustment, error) {
+	query := tx.Model(&models.Item{}).Where("id = ?", adj.ItemID)
+	if adj.Delta < 0 {
+		query = query.Where("stock >= ?", -adj.Delta)
+	}
+
+	result := query.UpdateColumn("stock", gorm.Expr("stock + ?", adj.Delta))
+	if result.Error != nil {
+		return adj, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return adj, errInsufficientStock
+	}
+
+	var item models.Item
+	if err := tx.Select("stock").First(&item, adj.ItemID).Error; err != nil {
+		return adj, err
+	}
+	adj.StockAfter = item.Stock
+
+	if err := tx.Create(&adj).Error; err != nil {
+		return adj, err
+	}
+	return adj, nil
+}
@@ -1,29 +1,172 @@
 package handlers
 
 import (
+	"fmt"
 	"net/http"
 	"shopping-cart/config"
 	"shopping-cart/models"
+	"shopping-cart/money"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
 )
 
-func GetItems(c *gin.Context) {
-	var items []models.Item
-	result := config.DB.Find(&items)
+// itemSortColumns maps the sort query values to item columns.
+var itemSortColumns = map[string]string{
+	"price":      "price_amount",
+	"name":       "name",
+	"created_at": "created_at",
+}
 
-	if result.Error != nil {
+// filterItems applies the category, brand, price range and sort query
+// parameters to an items query. The status filter is only honoured when
+// allowStatus is set; otherwise only active items are returned.
+func filterItems(c *gin.Context, query *gorm.DB, allowStatus bool) (*gorm.DB, error) {
+	if category := c.Query("category"); category != "" {
+		query = query.Where("category = ?", category)
+	}
+
+	if brand := c.Query("brand"); brand != "" {
+		query = query.Where("brand = ?", brand)
+	}
+
+	var minPrice, maxPrice money.Money
+	if raw := c.Query("min_price"); raw != "" {
+		value, err := money.Parse(raw, money.DefaultCurrency)
+		if err != nil || value.Amount < 0 {
+			return nil, fmt.Errorf("min_price must be a non-negative amount")
+		}
+		minPrice = value
+		query = query.Where("price_amount >= ?", minPrice.Amount)
+	}
+	if raw := c.Query("max_price"); raw != "" {
+		value, err := money.Parse(raw, money.DefaultCurrency)
+		if err != nil || value.Amount < 0 {
+			return nil, fmt.Errorf("max_price must be a non-negative amount")
+		}
+		maxPrice = value
+		if c.Query("min_price") != "" && maxPrice.Amount < minPrice.Amount {
+			return nil, fmt.Errorf("max_price must not be less than min_price")
+		}
+		query = query.Where("price_amount <= ?", maxPrice.Amount)
+	}
+
+	status := c.Query("status")
+	if !allowStatus {
+		status = models.ItemStatusActive
+	}
+	if status != "" {
+		if !models.ValidItemStatus(status) {
+			return nil, fmt.Errorf("status must be active or inactive")
+		}
+		query = query.Where("status = ?", status)
+	}
+
+	return query, nil
+}
+
+// sortItems applies the sort and order query parameters, defaulting to
+// ascending by ID so pages are stable.
+func sortItems(c *gin.Context, query *gorm.DB) (*gorm.DB, error) {
+	sort := c.DefaultQuery("sort", "id")
+	order := c.DefaultQuery("order", "asc")
+
+	if order != "asc" && order != "desc" {
+		return nil, fmt.Errorf("order must be asc or desc")
+	}
+
+	if sort == "id" {
+		return query.Order("id " + order), nil
+	}
+
+	column, ok := itemSortColumns[sort]
+	if !ok {
+		return nil, fmt.Errorf("sort must be one of price, name or created_at")
+	}
+	return query.Order(column + " " + order).Order("id " + order), nil
+}
+
+// listItems serves one page of the filtered and sorted catalogue.
+func listItems(c *gin.Context, allowStatus bool) {
+	params, err := parsePageParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query, err := filterItems(c, config.DB.Model(&models.Item{}), allowStatus)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var total int
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error counting items"})
+		return
+	}
+
+	query, err = sortItems(c, query)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	items := []models.Item{}
+	if err := query.Offset(params.Offset()).Limit(params.PageSize).Find(&items).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching items"})
 		return
 	}
 
-	if len(items) == 0 {
-		c.JSON(http.StatusOK, []models.Item{})
+	c.JSON(http.StatusOK, pageResponse(items, params, total))
+}
+
+func GetItems(c *gin.Context) {
+	listItems(c, false)
+}
+
+func SearchItems(c *gin.Context) {
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "q is required"})
+		return
+	}
+
+	params, err := parsePageParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ids, total, err := config.Search.Search(query, params.Offset(), params.PageSize)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error searching items"})
 		return
 	}
 
-	c.JSON(http.StatusOK, items)
+	var found []models.Item
+	if len(ids) > 0 {
+		if err := config.DB.Where("id IN (?) AND status = ?", ids, models.ItemStatusActive).Find(&found).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching items"})
+			return
+		}
+	}
+
+	// Restore the relevance order the search returned
+	byID := make(map[int]models.Item, len(found))
+	for _, item := range found {
+		byID[item.ID] = item
+	}
+	items := []models.Item{}
+	for _, id := range ids {
+		if item, ok := byID[id]; ok {
+			items = append(items, item)
+		}
+	}
+
+	c.JSON(http.StatusOK, pageResponse(items, params, total))
 }
 
 func GetItem(c *gin.Context) {
@@ -35,7 +178,7 @@ func GetItem(c *gin.Context) {
 	}
 
 	var item models.Item
-	result := config.DB.First(&item, itemID)
+	result := config.DB.Where("status = ?", models.ItemStatusActive).First(&item, itemID)
 
 	if result.Error != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
@@ -0,0 +1,645 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"shopping-cart/config"
+	"shopping-cart/models"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+// maxListNameLength caps the length of a cart or wishlist name.
+const maxListNameLength = 64
+
+// savedCartName is the name given to a user's save for later list.
+const savedCartName = "Saved for later"
+
+// defaultCartName is the name given to a cart started without one.
+const defaultCartName = "Shopping Cart"
+
+// userCartStatuses are the statuses of carts a user can still use; ordered
+// carts are left out.
+var userCartStatuses = []string{models.CartStatusActive, models.CartStatusOpen, models.CartStatusSaved}
+
+// validateListName returns a message describing what is wrong with the name
+// of a cart or wishlist, or an empty string if it can be used.
+func validateListName(name string) string {
+	if name == "" {
+		return "Name is required"
+	}
+	if len(name) > maxListNameLength {
+		return "Name must be at most " + strconv.Itoa(maxListNameLength) + " characters"
+	}
+	return ""
+}
+
+// cartNameTaken reports whether another of the user's carts already uses
+// cart's name.
+func cartNameTaken(db *gorm.DB, cart models.Cart) (bool, error) {
+	var count int
+	err := db.Model(&models.Cart{}).
+		Where("user_id = ? AND status IN (?) AND name = ? AND id <> ?", cart.UserID, userCartStatuses, cart.Name, cart.ID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// unusedDefaultCartName returns defaultCartName, or if one of the user's
+// carts already has that name the first of "Shopping Cart 2", "Shopping
+// Cart 3" and so on that is free.
+func unusedDefaultCartName(db *gorm.DB, userID int) (string, error) {
+	cart := models.Cart{UserID: userID, Name: defaultCartName}
+	for n := 2; ; n++ {
+		taken, err := cartNameTaken(db, cart)
+		if err != nil || !taken {
+			return cart.Name, err
+		}
+		cart.Name = defaultCartName + " " + strconv.Itoa(n)
+	}
+}
+
+// setActiveCart makes the cart the user's only active cart within tx,
+// leaving their previous active cart open.
+func setActiveCart(tx *gorm.DB, userID, cartID int) error {
+	if err := tx.Model(&models.Cart{}).
+		Where("user_id = ? AND status = ? AND id <> ?", userID, models.CartStatusActive, cartID).
+		Update("status", models.CartStatusOpen).Error; err != nil {
+		return err
+	}
+	return tx.Model(&models.Cart{}).Where("id = ?", cartID).Update("status", models.CartStatusActive).Error
+}
+
+// savedCart finds the user's save for later list, creating it if they have
+// none yet.
+func savedCart(db *gorm.DB, userID int) (models.Cart, error) {
+	var cart models.Cart
+	err := db.Where("user_id = ? AND status = ?", userID, models.CartStatusSaved).First(&cart).Error
+	if !gorm.IsRecordNotFoundError(err) {
+		return cart, err
+	}
+
+	cart = models.Cart{
+		UserID: userID,
+		Status: models.CartStatusSaved,
+		Name:   savedCartName,
+	}
+	return cart, db.Create(&cart).Error
+}
+
+// findCartParam loads the cart named in the URL. Carts belonging to someone
+// else, and checked out carts, are reported as not found.
+func findCartParam(c *gin.Context, userID int) (models.Cart, bool) {
+	var cart models.Cart
+	cartID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cart ID"})
+		return cart, false
+	}
+
+	if err := config.DB.Where("id = ? AND user_id = ? AND status IN (?)", cartID, userID, userCartStatuses).
+		First(&cart).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Cart not found"})
+		return cart, false
+	}
+	return cart, true
+}
+
+// cartListEntry summarizes a cart for listing: its name and status with the
+// totals from cartSummary, but not the lines.
+func cartListEntry(db *gorm.DB, cart models.Cart) (gin.H, error) {
+	summary, err := cartSummary(db, cart)
+	if err != nil {
+		return nil, err
+	}
+	delete(summary, "items")
+	return summary, nil
+}
+
+// moveError reports a cart line that can't be moved.
+type moveError struct {
+	Status  int
+	Message string
+	Details gin.H
+}
+
+func (e *moveError) Error() string {
+	return e.Message
+}
+
+// response renders the error for the client.
+func (e *moveError) response() gin.H {
+	body := gin.H{"error": e.Message}
+	for key, value := range e.Details {
+		body[key] = value
+	}
+	return body
+}
+
+// moveCartLine moves quantity units of an item from one of the user's carts
+// to another within tx, or the whole line if quantity is zero. A shopping
+// cart only takes units of items on sale and in stock; the save for later
+// list takes any item. Either way the destination line stays within the
+// per-line maximum. It returns the destination line's quantity; refusals are
+// returned as a *moveError.
+func moveCartLine(tx *gorm.DB, from, to models.Cart, itemID, quantity int) (int, error) {
+	if from.ID == to.ID {
+		return 0, &moveError{Status: http.StatusBadRequest, Message: "Cannot move an item to the cart it is in"}
+	}
+
+	var line models.CartItem
+	if err := tx.Where("cart_id = ? AND item_id = ?", from.ID, itemID).First(&line).Error; err != nil {
+		if gorm.IsRecordNotFoundError(err) {
+			return 0, &moveError{Status: http.StatusNotFound, Message: "Item not in cart"}
+		}
+		return 0, err
+	}
+	if quantity == 0 {
+		quantity = line.Quantity
+	}
+	if quantity < 0 || quantity > line.Quantity {
+		return 0, &moveError{
+			Status:  http.StatusBadRequest,
+			Message: "Quantity must be between 1 and the units in the cart",
+			Details: gin.H{"in_cart": line.Quantity},
+		}
+	}
+
+	// The save for later list takes any item; a shopping cart takes items
+	// the same way AddToCart does
+	var moved int
+	var err error
+	if to.Status == models.CartStatusSaved {
+		moved, err = addToCartLine(tx, to.ID, itemID, quantity, maxCartLineQuantity)
+		if errors.Is(err, errLineLimit) {
+			err = errMaxPerItem
+		}
+	} else {
+		var item models.Item
+		if item, err = findItemOnSale(tx, itemID); err == nil {
+			moved, err = addItemToCart(tx, to.ID, item, quantity)
+		}
+		if errors.Is(err, errNotEnoughStock) {
+			return moved, &moveError{
+				Status:  http.StatusConflict,
+				Message: "Not enough stock available",
+				Details: gin.H{"available": item.Stock},
+			}
+		}
+	}
+	switch {
+	case errors.Is(err, errItemNotOnSale):
+		return 0, &moveError{Status: http.StatusConflict, Message: "Item is no longer available"}
+	case errors.Is(err, errMaxPerItem):
+		return moved, &moveError{
+			Status:  http.StatusBadRequest,
+			Message: "Quantity exceeds the maximum per item",
+			Details: gin.H{"max_quantity": maxCartLineQuantity},
+		}
+	case err != nil:
+		return 0, err
+	}
+
+	if quantity == line.Quantity {
+		err = tx.Delete(&line).Error
+	} else {
+		err = tx.Model(&line).Update("quantity", line.Quantity-quantity).Error
+	}
+	return moved, err
+}
+
+// respondMove reports the outcome of moving a cart line, with both carts'
+// summaries on success.
+func respondMove(c *gin.Context, from, to models.Cart, itemID int, err error) {
+	var refused *moveError
+	if errors.As(err, &refused) {
+		c.JSON(refused.Status, refused.response())
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error moving cart item"})
+		return
+	}
+
+	fromSummary, err := cartSummary(config.DB, from)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching cart items"})
+		return
+	}
+	toSummary, err := cartSummary(config.DB, to)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching cart items"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Item moved successfully",
+		"item_id": itemID,
+		"from":    fromSummary,
+		"to":      toSummary,
+	})
+}
+
+// ListCarts returns the user's carts, including their save for later list,
+// with each one's totals. The active cart comes first.
+func ListCarts(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var carts []models.Cart
+	if err := config.DB.Where("user_id = ? AND status IN (?)", userID, userCartStatuses).
+		Order("status = 'active' DESC, id").Find(&carts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching carts"})
+		return
+	}
+
+	entries := []gin.H{}
+	for _, cart := range carts {
+		entry, err := cartListEntry(config.DB, cart)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching carts"})
+			return
+		}
+		entries = append(entries, entry)
+	}
+
+	c.JSON(http.StatusOK, entries)
+}
+
+func GetCart(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	cart, ok := findCartParam(c, userID.(int))
+	if !ok {
+		return
+	}
+
+	response, err := cartSummary(config.DB, cart)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching cart items"})
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// CreateCart starts a named cart with {"name": "Office", "active": true}. It
+// becomes the active cart if asked to, or if the user has no active cart.
+func CreateCart(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var input struct {
+		Name   string `json:"name"`
+		Active bool   `json:"active"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	cart := models.Cart{
+		UserID: userID.(int),
+		Name:   strings.TrimSpace(input.Name),
+		Status: models.CartStatusOpen,
+	}
+	if msg := validateListName(cart.Name); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	var taken bool
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if taken, err = cartNameTaken(tx, cart); err != nil || taken {
+			return err
+		}
+
+		if !input.Active {
+			_, err := activeCart(tx, cartOwner{UserID: cart.UserID})
+			if err != nil && !gorm.IsRecordNotFoundError(err) {
+				return err
+			}
+			input.Active = err != nil
+		}
+
+		if err := tx.Create(&cart).Error; err != nil {
+			return err
+		}
+		if input.Active {
+			cart.Status = models.CartStatusActive
+			return setActiveCart(tx, cart.UserID, cart.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating cart"})
+		return
+	}
+	if taken {
+		c.JSON(http.StatusConflict, gin.H{"error": "You already have a cart with that name"})
+		return
+	}
+
+	response, err := cartSummary(config.DB, cart)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching cart items"})
+		return
+	}
+	c.JSON(http.StatusCreated, response)
+}
+
+// RenameCart renames one of the user's carts with {"name": "..."}.
+func RenameCart(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	cart, ok := findCartParam(c, userID.(int))
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Name string `json:"name"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	cart.Name = strings.TrimSpace(input.Name)
+	if msg := validateListName(cart.Name); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	var taken bool
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if taken, err = cartNameTaken(tx, cart); err != nil || taken {
+			return err
+		}
+		return tx.Model(&cart).Update("name", cart.Name).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating cart"})
+		return
+	}
+	if taken {
+		c.JSON(http.StatusConflict, gin.H{"error": "You already have a cart with that name"})
+		return
+	}
+
+	response, err := cartSummary(config.DB, cart)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching cart items"})
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// ActivateCart makes one of the user's open carts the active cart, which
+// items are added to and which is checked out.
+func ActivateCart(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	cart, ok := findCartParam(c, userID.(int))
+	if !ok {
+		return
+	}
+	if cart.Status == models.CartStatusSaved {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "The save for later list can't be made the active cart"})
+		return
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		return setActiveCart(tx, cart.UserID, cart.ID)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating cart"})
+		return
+	}
+	cart.Status = models.CartStatusActive
+
+	response, err := cartSummary(config.DB, cart)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching cart items"})
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// DeleteCart removes one of the user's carts and its lines. If it was the
+// active cart, the most recently created open cart becomes active.
+func DeleteCart(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	cart, ok := findCartParam(c, userID.(int))
+	if !ok {
+		return
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("cart_id = ?", cart.ID).Delete(&models.CartItem{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(&cart).Error; err != nil {
+			return err
+		}
+		if cart.Status != models.CartStatusActive {
+			return nil
+		}
+
+		var next models.Cart
+		err := tx.Where("user_id = ? AND status = ?", cart.UserID, models.CartStatusOpen).Order("id DESC").First(&next).Error
+		if gorm.IsRecordNotFoundError(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return setActiveCart(tx, next.UserID, next.ID)
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting cart"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Cart deleted successfully"})
+}
+
+// MoveCartItem moves an item's line from one of the user's carts to another
+// with {"to_cart_id": n, "quantity": n}. Without a quantity the whole line
+// moves.
+func MoveCartItem(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	from, ok := findCartParam(c, userID.(int))
+	if !ok {
+		return
+	}
+
+	itemID, err := strconv.Atoi(c.Param("item_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item ID"})
+		return
+	}
+
+	var input struct {
+		ToCartID int `json:"to_cart_id" binding:"required"`
+		Quantity int `json:"quantity"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var to models.Cart
+	if err := config.DB.Where("id = ? AND user_id = ? AND status IN (?)", input.ToCartID, userID, userCartStatuses).
+		First(&to).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Destination cart not found"})
+		return
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		_, err := moveCartLine(tx, from, to, itemID, input.Quantity)
+		return err
+	})
+	respondMove(c, from, to, itemID, err)
+}
+
+// GetSavedForLater returns the user's save for later list.
+func GetSavedForLater(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	saved, err := savedCart(config.DB, userID.(int))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching saved items"})
+		return
+	}
+
+	response, err := cartSummary(config.DB, saved)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching saved items"})
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// SaveForLater moves an item's line from the active cart to the save for
+// later list, optionally only {"quantity": n} units of it.
+func SaveForLater(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	itemID, quantity, ok := bindMoveRequest(c)
+	if !ok {
+		return
+	}
+
+	var from, to models.Cart
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if from, err = activeCart(tx, cartOwner{UserID: userID.(int)}); err != nil {
+			if gorm.IsRecordNotFoundError(err) {
+				return &moveError{Status: http.StatusNotFound, Message: "No active cart found"}
+			}
+			return err
+		}
+		if to, err = savedCart(tx, userID.(int)); err != nil {
+			return err
+		}
+		_, err = moveCartLine(tx, from, to, itemID, quantity)
+		return err
+	})
+	respondMove(c, from, to, itemID, err)
+}
+
+// MoveToCart moves an item's line from the save for later list back to the
+// active cart, optionally only {"quantity": n} units of it. The active cart
+// is created if the user has none.
+func MoveToCart(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	itemID, quantity, ok := bindMoveRequest(c)
+	if !ok {
+		return
+	}
+
+	owner := cartOwner{UserID: userID.(int)}
+	var from, to models.Cart
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if from, err = savedCart(tx, owner.UserID); err != nil {
+			return err
+		}
+		to, err = activeCart(tx, owner)
+		if gorm.IsRecordNotFoundError(err) {
+			to, _, err = createActiveCart(tx, owner)
+		}
+		if err != nil {
+			return err
+		}
+		_, err = moveCartLine(tx, from, to, itemID, quantity)
+		return err
+	})
+	respondMove(c, from, to, itemID, err)
+}
+
+// bindMoveRequest reads the item ID from the URL and the optional quantity
+// from the body of a save for later request.
+func bindMoveRequest(c *gin.Context) (itemID, quantity int, ok bool) {
+	itemID, err := strconv.Atoi(c.Param("item_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item ID"})
+		return 0, 0, false
+	}
+
+	var input struct {
+		Quantity int `json:"quantity"`
+	}
+	if c.Request.ContentLength != 0 {
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return 0, 0, false
+		}
+	}
+	return itemID, input.Quantity, true
+}
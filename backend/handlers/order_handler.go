@@ -1,11 +1,15 @@
 package handlers
 
 import (
+	"errors"
+	"io"
 	"net/http"
 	"shopping-cart/config"
 	"shopping-cart/models"
+	"strconv"
 
 	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
 )
 
 func CreateOrder(c *gin.Context) {
@@ -15,107 +19,295 @@ func CreateOrder(c *gin.Context) {
 		return
 	}
 
-	// Get user's active cart
-	var cart models.Cart
-	if err := config.DB.Where("user_id = ? AND status = ?", userID, "active").First(&cart).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "No active cart found"})
+	var req checkoutRequest
+	if err := c.ShouldBindJSON(&req); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Check if cart has items
-	var cartItemsCount int64
-	if err := config.DB.Model(&models.CartItem{}).Where("cart_id = ?", cart.ID).Count(&cartItemsCount).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking cart items"})
+	// The whole checkout commits or rolls back as one
+	var order models.Order
+	var lines []models.OrderItem
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		order, lines, err = placeOrder(tx, userID.(int), req)
+		return err
+	})
+
+	var failure *checkoutError
+	if errors.As(err, &failure) {
+		c.JSON(failure.Status, failure.response())
 		return
 	}
-
-	if cartItemsCount == 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Cart is empty"})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Checkout failed", "step": stepCommit})
 		return
 	}
 
-	// Create new order
-	order := models.Order{
-		UserID: userID.(int),
-		CartID: cart.ID,
+	if req.PaymentToken != "" {
+		err = payOrder(&order, req.PaymentToken, userID.(int))
+
+		// The order stands either way; report it so it can be paid again
+		var declined *paymentError
+		if errors.As(err, &declined) {
+			body := declined.response()
+			body["step"] = stepPayment
+			body["order_id"] = order.ID
+			body["status"] = order.Status
+			c.JSON(declined.Status, body)
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error":    "Error taking payment",
+				"step":     stepPayment,
+				"order_id": order.ID,
+				"status":   order.Status,
+			})
+			return
+		}
 	}
 
-	if err := config.DB.Create(&order).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating order"})
+	response := orderResponse(order, lines)
+	response["order_id"] = order.ID
+	response["message"] = "Order created successfully"
+	c.JSON(http.StatusOK, response)
+}
+
+func GetUserOrders(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
 		return
 	}
 
-	// Update cart status to "ordered"
-	cart.Status = "ordered"
-	if err := config.DB.Save(&cart).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating cart status"})
+	var orders []models.Order
+	if err := config.DB.Where("user_id = ?", userID).Find(&orders).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching orders"})
 		return
 	}
 
-	// Get order details with items
-	var items []models.Item
-	if err := config.DB.Table("items").
-		Joins("JOIN cart_items ON cart_items.item_id = items.id").
-		Where("cart_items.cart_id = ?", cart.ID).
-		Find(&items).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching order items"})
-		return
+	// Build each order from its line snapshots
+	orderResponses := []gin.H{}
+	for _, order := range orders {
+		var lines []models.OrderItem
+		if err := config.DB.Where("order_id = ?", order.ID).Order("id").Find(&lines).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching order items"})
+			return
+		}
+
+		orderResponses = append(orderResponses, orderResponse(order, lines))
 	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"order_id": order.ID,
-		"items":    items,
-		"status":   "success",
-		"message":  "Order created successfully",
-	})
+	c.JSON(http.StatusOK, orderResponses)
 }
 
-func GetUserOrders(c *gin.Context) {
+// orderResponse renders an order and its snapshotted lines. Lines keep the
+// id and price keys of the catalogue item so clients can treat them alike.
+func orderResponse(order models.Order, lines []models.OrderItem) gin.H {
+	items := []gin.H{}
+	for _, line := range lines {
+		items = append(items, gin.H{
+			"id":           line.ItemID,
+			"name":         line.Name,
+			"description":  line.Description,
+			"price":        line.UnitPrice,
+			"category":     line.Category,
+			"brand":        line.Brand,
+			"image_urls":   line.ImageURLs,
+			"quantity":     line.Quantity,
+			"line_total":   line.LineTotal,
+			"discount":     line.Discount,
+			"tax_rate_bps": line.TaxRate,
+			"tax":          line.Tax,
+		})
+	}
+
+	return gin.H{
+		"id":               order.ID,
+		"status":           order.Status,
+		"refund_status":    order.RefundStatus,
+		"created_at":       order.CreatedAt,
+		"items":            items,
+		"subtotal":         order.Subtotal,
+		"tax":              order.Tax,
+		"discount":         order.Discount,
+		"coupon_code":      order.CouponCode,
+		"tax_region":       order.TaxRegion,
+		"tax_inclusive":    order.TaxInclusive,
+		"shipping_address": order.ShippingAddress,
+		"shipping_method":  order.ShippingMethod,
+		"shipping":         order.Shipping,
+		"total":            order.Total,
+	}
+}
+
+// CancelOrder lets a shopper cancel one of their own orders until it has
+// shipped. Orders belonging to someone else are reported as not found.
+func CancelOrder(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
 		return
 	}
 
-	var orders []models.Order
-	if err := config.DB.Where("user_id = ?", userID).Find(&orders).Error; err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching orders"})
+	orderID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
 		return
 	}
 
-	// Get items for each order with quantities
-	var orderResponses []gin.H
-	for _, order := range orders {
-		var cartItems []models.CartItem
-		if err := config.DB.Where("cart_id = ?", order.CartID).Find(&cartItems).Error; err != nil {
+	var input struct {
+		Reason string `json:"reason"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil && err != io.EOF {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var order models.Order
+	if err := config.DB.Where("id = ? AND user_id = ?", orderID, userID).First(&order).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		return cancelOrder(tx, &order, userID.(int), input.Reason)
+	})
+
+	var invalid *invalidTransitionError
+	if errors.As(err, &invalid) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":          "Order can no longer be cancelled",
+			"current_status": invalid.Current,
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error cancelling order"})
+		return
+	}
+
+	// Give back what was paid. A failed refund leaves the order cancelled
+	// and is reported with it, to be retried by an admin
+	refund, refundErr := refundCancelledOrder(order, input.Reason, userID.(int))
+
+	var lines []models.OrderItem
+	if err := config.DB.Where("order_id = ?", order.ID).Order("id").Find(&lines).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching order items"})
+		return
+	}
+
+	response := orderResponse(order, lines)
+	if refund != nil {
+		response["refund"] = refund
+	}
+	if refundErr != nil {
+		response["refund_error"] = refundErrorMessage(refundErr)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// reorderLines copies order lines into a cart within tx, adding as many units
+// of each as fit within stock and the per-line maximum, counting units the
+// cart already holds.
+func reorderLines(tx *gorm.DB, cartID int, lines []models.OrderItem) (cartCopyResult, error) {
+	result := newCartCopyResult(cartID)
+	for _, line := range lines {
+		outcome := lineOutcome{ItemID: line.ItemID, Requested: line.Quantity}
+
+		var current models.CartItem
+		err := tx.Where("cart_id = ? AND item_id = ?", cartID, line.ItemID).First(&current).Error
+		if err != nil && !gorm.IsRecordNotFoundError(err) {
+			return result, err
+		}
+		outcome.Quantity = current.Quantity
+
+		item, err := findItemOnSale(tx, line.ItemID)
+		if errors.Is(err, errItemNotOnSale) {
+			outcome.Reason = reasonUnavailable
+			result.Skipped = append(result.Skipped, outcome)
 			continue
 		}
+		if err != nil {
+			return result, err
+		}
 
-		var itemsWithQuantity []gin.H
-		for _, cartItem := range cartItems {
-			var item models.Item
-			if err := config.DB.First(&item, cartItem.ItemID).Error; err != nil {
-				continue
+		limit, limitReason := maxCartLineQuantity, reasonLineLimit
+		if item.Stock < limit {
+			limit, limitReason = item.Stock, reasonStockLimit
+		}
+		quantity := line.Quantity
+		if current.Quantity+quantity > limit {
+			quantity = limit - current.Quantity
+			outcome.Reason = limitReason
+		}
+		if quantity <= 0 {
+			if item.Stock == 0 {
+				outcome.Reason = reasonOutOfStock
 			}
+			result.Skipped = append(result.Skipped, outcome)
+			continue
+		}
 
-			itemsWithQuantity = append(itemsWithQuantity, gin.H{
-				"id":          item.ID,
-				"name":        item.Name,
-				"price":       item.Price,
-				"category":    item.Category,
-				"brand":       item.Brand,
-				"description": item.Description,
-				"image_urls":  item.ImageURLs,
-				"quantity":    cartItem.Quantity,
-			})
+		if outcome.Quantity, err = addToCartLine(tx, cartID, item.ID, quantity, limit); err != nil {
+			return result, err
 		}
+		if outcome.Reason != "" {
+			result.Adjusted = append(result.Adjusted, outcome)
+		} else {
+			result.Added = append(result.Added, outcome)
+		}
+	}
+	return result, nil
+}
 
-		orderResponses = append(orderResponses, gin.H{
-			"id":         order.ID,
-			"created_at": order.CreatedAt,
-			"items":      itemsWithQuantity,
-		})
+// ReorderOrder copies the lines of one of the user's orders into their active
+// cart, to be bought again at current prices. Lines for items that are off
+// sale or out of stock are skipped, and lines that don't fit in full are cut
+// down; the response reports which.
+func ReorderOrder(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
 	}
 
-	c.JSON(http.StatusOK, orderResponses)
+	orderID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	var order models.Order
+	if err := config.DB.Where("id = ? AND user_id = ?", orderID, userID).First(&order).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+
+	var result cartCopyResult
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		var lines []models.OrderItem
+		if err := tx.Where("order_id = ?", order.ID).Order("id").Find(&lines).Error; err != nil {
+			return err
+		}
+
+		owner := cartOwner{UserID: order.UserID}
+		cart, err := activeCart(tx, owner)
+		if gorm.IsRecordNotFoundError(err) {
+			cart, _, err = createActiveCart(tx, owner)
+		}
+		if err != nil {
+			return err
+		}
+
+		result, err = reorderLines(tx, cart.ID, lines)
+		return err
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error adding order items to cart"})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
 }
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"shopping-cart/models"
+
+	"github.com/jinzhu/gorm"
+)
+
+// invalidTransitionError is returned when an order can't move to the
+// requested status from the one it is in.
+type invalidTransitionError struct {
+	Current   string
+	Requested string
+}
+
+func (e *invalidTransitionError) Error() string {
+	return fmt.Sprintf("cannot move order from %s to %s", e.Current, e.Requested)
+}
+
+// transitionOrder moves order to status within tx and records the change.
+// The update only applies if the order is still in the status it was read
+// with, so two concurrent changes can't both succeed.
+func transitionOrder(tx *gorm.DB, order *models.Order, status string, changedBy int, note string) error {
+	if !models.CanTransitionOrder(order.Status, status) {
+		return &invalidTransitionError{Current: order.Status, Requested: status}
+	}
+
+	result := tx.Model(&models.Order{}).
+		Where("id = ? AND status = ?", order.ID, order.Status).
+		Update("status", status)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		var current models.Order
+		if err := tx.Select("status").First(&current, order.ID).Error; err != nil {
+			return err
+		}
+		return &invalidTransitionError{Current: current.Status, Requested: status}
+	}
+
+	change := models.OrderStatusChange{
+		OrderID:    order.ID,
+		FromStatus: order.Status,
+		ToStatus:   status,
+		ChangedBy:  changedBy,
+		Note:       note,
+	}
+	if err := tx.Create(&change).Error; err != nil {
+		return err
+	}
+
+	order.Status = status
+	return nil
+}
+
+// cancelOrder cancels order within tx, puts the stock taken at checkout back
+// and releases any coupon it used. Units already refunded were restocked, or
+// written off, by their refund and aren't restocked again.
+func cancelOrder(tx *gorm.DB, order *models.Order, changedBy int, reason string) error {
+	if err := transitionOrder(tx, order, models.OrderStatusCancelled, changedBy, reason); err != nil {
+		return err
+	}
+
+	var lines []models.OrderItem
+	if err := tx.Where("order_id = ?", order.ID).Find(&lines).Error; err != nil {
+		return err
+	}
+	_, refundedUnits, err := refundedSoFar(tx, order.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, line := range lines {
+		quantity := line.Quantity - refundedUnits[line.ID]
+		if quantity <= 0 {
+			continue
+		}
+		_, err := adjustStock(tx, models.StockAdjustment{
+			ItemID:  line.ItemID,
+			Delta:   quantity,
+			Reason:  models.StockReasonCancel,
+			Note:    reason,
+			UserID:  changedBy,
+			OrderID: order.ID,
+		})
+		// Items deleted since checkout have nothing to restock
+		if err != nil && !errors.Is(err, errInsufficientStock) {
+			return err
+		}
+	}
+	return releaseCoupon(tx, order.ID)
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+type pageParams struct {
+	Page     int
+	PageSize int
+}
+
+func (p pageParams) Offset() int {
+	return (p.Page - 1) * p.PageSize
+}
+
+// parsePageParams reads page and page_size from the query string, applying
+// defaults and rejecting out-of-range values.
+func parsePageParams(c *gin.Context) (pageParams, error) {
+	params := pageParams{Page: 1, PageSize: defaultPageSize}
+
+	if raw := c.Query("page"); raw != "" {
+		page, err := strconv.Atoi(raw)
+		if err != nil || page < 1 {
+			return params, fmt.Errorf("page must be a positive integer")
+		}
+		params.Page = page
+	}
+
+	if raw := c.Query("page_size"); raw != "" {
+		size, err := strconv.Atoi(raw)
+		if err != nil || size < 1 || size > maxPageSize {
+			return params, fmt.Errorf("page_size must be between 1 and %d", maxPageSize)
+		}
+		params.PageSize = size
+	}
+
+	return params, nil
+}
+
+// pageResponse wraps one page of results with the paging metadata.
+func pageResponse(items interface{}, params pageParams, total int) gin.H {
+	totalPages := (total + params.PageSize - 1) / params.PageSize
+	return gin.H{
+		"items":       items,
+		"page":        params.Page,
+		"page_size":   params.PageSize,
+		"total":       total,
+		"total_pages": totalPages,
+	}
+}
@@ -0,0 +1,233 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"shopping-cart/config"
+	"shopping-cart/models"
+	"shopping-cart/money"
+	"shopping-cart/payment"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+// stepPayment names payment in checkout failures. Payment is taken after the
+// order is committed, so an order survives a failed payment and can be paid
+// again with PayOrder.
+const stepPayment = "payment"
+
+// paymentError reports a payment the provider declined or couldn't process.
+type paymentError struct {
+	Status  int
+	Message string
+	Code    string
+	Err     error
+}
+
+func (e *paymentError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Message, e.Err)
+}
+
+func (e *paymentError) Unwrap() error {
+	return e.Err
+}
+
+// response renders the error for the client.
+func (e *paymentError) response() gin.H {
+	body := gin.H{"error": e.Message}
+	if e.Code != "" {
+		body["code"] = e.Code
+	}
+	return body
+}
+
+// paymentFailure classifies an error from the payment provider.
+func paymentFailure(err error) *paymentError {
+	var declined *payment.DeclinedError
+	if errors.As(err, &declined) {
+		return &paymentError{Status: http.StatusPaymentRequired, Message: "Payment declined", Code: declined.Code, Err: err}
+	}
+	return &paymentError{Status: http.StatusBadGateway, Message: "Payment provider unavailable", Err: err}
+}
+
+// newPayment records the outcome of one call to the payment provider for an
+// order. parent is the reference the call acted on, if any.
+func newPayment(orderID int, operation, parent string, amount money.Money, txn payment.Transaction, err error) models.Payment {
+	record := models.Payment{
+		OrderID:         orderID,
+		Provider:        config.Payments.Name(),
+		Operation:       operation,
+		Status:          models.PaymentSucceeded,
+		Amount:          amount,
+		Reference:       txn.ID,
+		ParentReference: parent,
+	}
+
+	var declined *payment.DeclinedError
+	switch {
+	case errors.As(err, &declined):
+		record.Status = models.PaymentDeclined
+		record.ErrorCode = declined.Code
+		record.ErrorMessage = declined.Message
+	case err != nil:
+		record.Status = models.PaymentFailed
+		record.ErrorMessage = err.Error()
+	}
+	return record
+}
+
+// recordPayment saves the outcome of a call to the payment provider.
+func recordPayment(db *gorm.DB, orderID int, operation, parent string, amount money.Money, txn payment.Transaction, err error) (models.Payment, error) {
+	record := newPayment(orderID, operation, parent, amount, txn, err)
+	return record, db.Create(&record).Error
+}
+
+// payOrder takes payment for a pending order: its total is authorized
+// against source and captured, and only then is the order marked paid. An
+// authorization that can't be captured is voided, and a capture for an order
+// that stopped being pending meanwhile is refunded. Declines and provider
+// failures are returned as a *paymentError.
+func payOrder(order *models.Order, source string, paidBy int) error {
+	if order.Status != models.OrderStatusPending {
+		return &invalidTransitionError{Current: order.Status, Requested: models.OrderStatusPaid}
+	}
+
+	// Nothing to collect, e.g. everything was discounted
+	if !order.Total.IsPositive() {
+		return config.DB.Transaction(func(tx *gorm.DB) error {
+			return transitionOrder(tx, order, models.OrderStatusPaid, paidBy, "Nothing to pay")
+		})
+	}
+
+	reference := "order-" + strconv.Itoa(order.ID)
+	auth, err := config.Payments.Authorize(source, order.Total, reference)
+	if _, recordErr := recordPayment(config.DB, order.ID, models.PaymentAuthorize, "", order.Total, auth, err); recordErr != nil {
+		if err == nil {
+			voidAuthorization(order.ID, auth.ID, order.Total)
+		}
+		return recordErr
+	}
+	if err != nil {
+		return paymentFailure(err)
+	}
+
+	capture, err := config.Payments.Capture(auth.ID, order.Total)
+	if err != nil {
+		recordPayment(config.DB, order.ID, models.PaymentCapture, auth.ID, order.Total, capture, err)
+		voidAuthorization(order.ID, auth.ID, order.Total)
+		return paymentFailure(err)
+	}
+
+	// The capture is recorded with the status change, so a paid order
+	// always has the capture that paid it
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if _, err := recordPayment(tx, order.ID, models.PaymentCapture, auth.ID, order.Total, capture, nil); err != nil {
+			return err
+		}
+		return transitionOrder(tx, order, models.OrderStatusPaid, paidBy, "Payment captured")
+	})
+	if err != nil {
+		refundCapture(config.Payments, order.ID, capture.ID, order.Total)
+		return err
+	}
+	return nil
+}
+
+// voidAuthorization releases an authorization that won't be captured. A
+// failure is recorded but otherwise ignored, as the authorization lapses on
+// its own.
+func voidAuthorization(orderID int, authorizationID string, amount money.Money) {
+	txn, err := config.Payments.Void(authorizationID)
+	recordPayment(config.DB, orderID, models.PaymentVoid, authorizationID, amount, txn, err)
+}
+
+// refundCapture gives amount of a capture back through refunder and records
+// the refund.
+func refundCapture(refunder payment.Refunder, orderID int, captureID string, amount money.Money) (models.Payment, error) {
+	txn, err := refunder.Refund(captureID, amount)
+	record, recordErr := recordPayment(config.DB, orderID, models.PaymentRefund, captureID, amount, txn, err)
+	if err != nil {
+		return record, paymentFailure(err)
+	}
+	return record, recordErr
+}
+
+// orderCapture returns the capture that paid for an order, if it was paid
+// through the payment provider.
+func orderCapture(db *gorm.DB, orderID int) (models.Payment, bool, error) {
+	var capture models.Payment
+	err := db.Where("order_id = ? AND operation = ? AND status = ?", orderID, models.PaymentCapture, models.PaymentSucceeded).
+		Order("id DESC").First(&capture).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return capture, false, nil
+	}
+	return capture, err == nil, err
+}
+
+// orderPayments lists the payment attempts for an order, oldest first.
+func orderPayments(db *gorm.DB, orderID int) ([]models.Payment, error) {
+	payments := []models.Payment{}
+	err := db.Where("order_id = ?", orderID).Order("id").Find(&payments).Error
+	return payments, err
+}
+
+// PayOrder takes payment for one of the shopper's pending orders with
+// {"payment_token": "..."}, e.g. after payment at checkout was declined.
+func PayOrder(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	orderID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	var input struct {
+		PaymentToken string `json:"payment_token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var order models.Order
+	if err := config.DB.Where("id = ? AND user_id = ?", orderID, userID).First(&order).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+
+	err = payOrder(&order, input.PaymentToken, userID.(int))
+
+	var invalid *invalidTransitionError
+	if errors.As(err, &invalid) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":          "Only pending orders can be paid",
+			"current_status": invalid.Current,
+		})
+		return
+	}
+	var failure *paymentError
+	if errors.As(err, &failure) {
+		c.JSON(failure.Status, failure.response())
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error taking payment"})
+		return
+	}
+
+	var lines []models.OrderItem
+	if err := config.DB.Where("order_id = ?", order.ID).Order("id").Find(&lines).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching order items"})
+		return
+	}
+
+	c.JSON(http.StatusOK, orderResponse(order, lines))
+}
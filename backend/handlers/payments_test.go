@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"path/filepath"
+	"shopping-cart/config"
+	"shopping-cart/models"
+	"shopping-cart/money"
+	"shopping-cart/payment"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+)
+
+// useTestPayments points config.DB at an empty database holding orders and
+// their payments, and config.Payments at a new fake gateway.
+func useTestPayments(t *testing.T) {
+	t.Helper()
+	db, err := gorm.Open("sqlite3", filepath.Join(t.TempDir(), "test.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	if err := db.AutoMigrate(&models.Order{}, &models.OrderStatusChange{}, &models.Payment{}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	previousDB, previousPayments := config.DB, config.Payments
+	config.DB, config.Payments = db, payment.NewFakeGateway()
+	t.Cleanup(func() { config.DB, config.Payments = previousDB, previousPayments })
+}
+
+func createPendingOrder(t *testing.T, total int64) *models.Order {
+	t.Helper()
+	order := &models.Order{
+		UserID: 1,
+		Status: models.OrderStatusPending,
+		Total:  money.New(total, money.DefaultCurrency),
+	}
+	if err := config.DB.Create(order).Error; err != nil {
+		t.Fatal(err)
+	}
+	return order
+}
+
+func TestPayOrder(t *testing.T) {
+	useTestPayments(t)
+	order := createPendingOrder(t, 1000)
+
+	if err := payOrder(order, "tok_visa", 1); err != nil {
+		t.Fatalf("payOrder = %v", err)
+	}
+	if order.Status != models.OrderStatusPaid {
+		t.Errorf("order status = %q; want %q", order.Status, models.OrderStatusPaid)
+	}
+	if _, ok, err := orderCapture(config.DB, order.ID); err != nil || !ok {
+		t.Errorf("orderCapture = %v, %v; want the capture", ok, err)
+	}
+}
+
+// An authorization whose capture is declined is voided, and the order stays
+// pending so it can be paid again.
+func TestPayOrderVoidsOnCaptureFailure(t *testing.T) {
+	useTestPayments(t)
+	order := createPendingOrder(t, 1000)
+
+	err := payOrder(order, payment.FakeSourceCaptureDeclined, 1)
+	var failure *paymentError
+	if !errors.As(err, &failure) || failure.Status != http.StatusPaymentRequired || failure.Code != "capture_declined" {
+		t.Fatalf("payOrder = %v; want a capture_declined payment error", err)
+	}
+
+	var current models.Order
+	if err := config.DB.First(&current, order.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if current.Status != models.OrderStatusPending {
+		t.Errorf("order status = %q; want %q", current.Status, models.OrderStatusPending)
+	}
+
+	payments, err := orderPayments(config.DB, order.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct{ operation, status string }{
+		{models.PaymentAuthorize, models.PaymentSucceeded},
+		{models.PaymentCapture, models.PaymentDeclined},
+		{models.PaymentVoid, models.PaymentSucceeded},
+	}
+	if len(payments) != len(want) {
+		t.Fatalf("recorded %d payments; want %d: %+v", len(payments), len(want), payments)
+	}
+	for i, w := range want {
+		if payments[i].Operation != w.operation || payments[i].Status != w.status {
+			t.Errorf("payment %d = %s %s; want %s %s", i, payments[i].Operation, payments[i].Status, w.operation, w.status)
+		}
+	}
+	if payments[2].ParentReference != payments[0].Reference {
+		t.Errorf("void references %q; want the authorization %q", payments[2].ParentReference, payments[0].Reference)
+	}
+
+	if err := payOrder(&current, "tok_visa", 1); err != nil {
+		t.Errorf("paying again after the declined capture = %v", err)
+	}
+}
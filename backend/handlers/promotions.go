@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"shopping-cart/models"
+	"shopping-cart/money"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+// couponError explains to the shopper why a coupon can't be used.
+type couponError string
+
+func (e couponError) Error() string {
+	return string(e)
+}
+
+const (
+	errCouponInvalid       couponError = "Coupon code is not valid"
+	errCouponNotStarted    couponError = "Coupon is not valid yet"
+	errCouponExpired       couponError = "Coupon has expired"
+	errCouponUsedUp        couponError = "Coupon has reached its usage limit"
+	errCouponUserLimit     couponError = "You have already used this coupon the maximum number of times"
+	errCouponNotApplicable couponError = "Coupon doesn't apply to the items in your cart"
+)
+
+// findCoupon looks up a coupon by code, case insensitively.
+func findCoupon(db *gorm.DB, code string) (models.Coupon, error) {
+	var coupon models.Coupon
+	err := db.Where("code = ?", models.NormalizeCouponCode(code)).First(&coupon).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return coupon, errCouponInvalid
+	}
+	return coupon, err
+}
+
+// checkCoupon returns a couponError if userID can't use coupon on lines at
+// now, or any error from reading their past redemptions.
+func checkCoupon(db *gorm.DB, coupon models.Coupon, userID int, lines []models.OrderItem, now time.Time) error {
+	if !coupon.Active {
+		return errCouponInvalid
+	}
+	if coupon.StartsAt != nil && now.Before(*coupon.StartsAt) {
+		return errCouponNotStarted
+	}
+	if coupon.EndsAt != nil && !now.Before(*coupon.EndsAt) {
+		return errCouponExpired
+	}
+	if coupon.UsageLimit > 0 && coupon.TimesRedeemed >= coupon.UsageLimit {
+		return errCouponUsedUp
+	}
+	if coupon.PerUserLimit > 0 {
+		var used int
+		if err := db.Model(&models.CouponRedemption{}).
+			Where("coupon_id = ? AND user_id = ?", coupon.ID, userID).
+			Count(&used).Error; err != nil {
+			return err
+		}
+		if used >= coupon.PerUserLimit {
+			return errCouponUserLimit
+		}
+	}
+
+	subtotal := money.Zero(money.DefaultCurrency)
+	eligible := false
+	for _, line := range lines {
+		subtotal = subtotal.Add(line.LineTotal)
+		eligible = eligible || coupon.Applies(line)
+	}
+	if subtotal.Amount < coupon.MinSpend.Amount {
+		return couponError(fmt.Sprintf("Spend at least %s %s to use this coupon", coupon.MinSpend, coupon.MinSpend.Currency))
+	}
+	if !eligible {
+		return errCouponNotApplicable
+	}
+
+	// A buy-x-get-y coupon needs enough of one item to earn a free unit
+	if coupon.Type == models.CouponBuyXGetY {
+		discounted := append([]models.OrderItem(nil), lines...)
+		applyCoupon(coupon, discounted)
+		earned := false
+		for _, line := range discounted {
+			earned = earned || line.Discount.IsPositive()
+		}
+		if !earned {
+			return couponError(fmt.Sprintf("Buy %d of an eligible item to get %d free", coupon.BuyQuantity, coupon.GetQuantity))
+		}
+	}
+	return nil
+}
+
+// appliedCoupon is a cart's coupon along with why it can't be used, if so.
+type appliedCoupon struct {
+	Coupon  models.Coupon
+	Problem error // A couponError, or nil if the coupon's discount applies
+}
+
+// freeShipping reports whether the coupon makes the cart's shipping free.
+func (a *appliedCoupon) freeShipping() bool {
+	return a != nil && a.Problem == nil && a.Coupon.Type == models.CouponFreeShipping
+}
+
+// applyCartCoupon discounts lines with the cart's coupon, if it has one and
+// it can still be used. It returns nil if the cart has no coupon.
+func applyCartCoupon(db *gorm.DB, cart models.Cart, lines []models.OrderItem) (*appliedCoupon, error) {
+	if cart.CouponID == 0 {
+		return nil, nil
+	}
+
+	var coupon models.Coupon
+	err := db.First(&coupon, cart.CouponID).Error
+	if gorm.IsRecordNotFoundError(err) {
+		// Deleted since it was applied
+		return &appliedCoupon{Coupon: coupon, Problem: errCouponInvalid}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	problem := checkCoupon(db, coupon, cart.UserID, lines, time.Now())
+	var reason couponError
+	if problem != nil && !errors.As(problem, &reason) {
+		return nil, problem
+	}
+	if problem == nil {
+		applyCoupon(coupon, lines)
+	}
+	return &appliedCoupon{Coupon: coupon, Problem: problem}, nil
+}
+
+// applyCoupon sets the discount on each of the lines the coupon covers. It
+// doesn't check whether the coupon may be used; see checkCoupon.
+func applyCoupon(coupon models.Coupon, lines []models.OrderItem) {
+	switch coupon.Type {
+	case models.CouponPercentOff:
+		for i, line := range lines {
+			if coupon.Applies(line) {
+				lines[i].Discount = line.LineTotal.MulBasisPoints(int64(coupon.PercentOff) * 100)
+			}
+		}
+
+	case models.CouponAmountOff:
+		// Spread the amount over the eligible lines in proportion to their
+		// totals, never taking off more than they cost
+		weights := make([]int64, len(lines))
+		eligible := money.Zero(coupon.AmountOff.Currency)
+		for i, line := range lines {
+			if coupon.Applies(line) {
+				weights[i] = line.LineTotal.Amount
+				eligible = eligible.Add(line.LineTotal)
+			}
+		}
+		shares := coupon.AmountOff.Min(eligible).Allocate(weights)
+		for i := range lines {
+			if weights[i] > 0 {
+				lines[i].Discount = shares[i]
+			}
+		}
+
+	case models.CouponBuyXGetY:
+		group := coupon.BuyQuantity + coupon.GetQuantity
+		for i, line := range lines {
+			if coupon.Applies(line) && group > 0 {
+				free := line.Quantity / group * coupon.GetQuantity
+				lines[i].Discount = line.UnitPrice.Mul(free)
+			}
+		}
+	}
+}
+
+// redeemCoupon records that order used coupon, within the checkout
+// transaction tx. The usage count is raised with a conditional update, so
+// concurrent checkouts can't take a coupon past its usage limit. The
+// shopper's redemptions are counted again in the same transaction, so they
+// can't go past the per user limit either.
+func redeemCoupon(tx *gorm.DB, coupon models.Coupon, order models.Order) error {
+	result := tx.Model(&models.Coupon{}).
+		Where("id = ? AND (usage_limit = 0 OR times_redeemed < usage_limit)", coupon.ID).
+		UpdateColumn("times_redeemed", gorm.Expr("times_redeemed + 1"))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errCouponUsedUp
+	}
+
+	// Counted after the increment, which holds the coupon row, so
+	// concurrent checkouts by the same shopper count one at a time
+	if coupon.PerUserLimit > 0 {
+		var used int
+		if err := tx.Model(&models.CouponRedemption{}).
+			Where("coupon_id = ? AND user_id = ?", coupon.ID, order.UserID).
+			Count(&used).Error; err != nil {
+			return err
+		}
+		if used >= coupon.PerUserLimit {
+			return errCouponUserLimit
+		}
+	}
+
+	return tx.Create(&models.CouponRedemption{
+		CouponID: coupon.ID,
+		UserID:   order.UserID,
+		OrderID:  order.ID,
+		Discount: order.Discount,
+	}).Error
+}
+
+// releaseCoupon gives back the use of a coupon redeemed by an order that has
+// been cancelled.
+func releaseCoupon(tx *gorm.DB, orderID int) error {
+	var redemption models.CouponRedemption
+	err := tx.Where("order_id = ?", orderID).First(&redemption).Error
+	if gorm.IsRecordNotFoundError(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := tx.Delete(&redemption).Error; err != nil {
+		return err
+	}
+	return tx.Model(&models.Coupon{}).
+		Where("id = ? AND times_redeemed > 0", redemption.CouponID).
+		UpdateColumn("times_redeemed", gorm.Expr("times_redeemed - 1")).Error
+}
@@ -0,0 +1,587 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"shopping-cart/config"
+	"shopping-cart/models"
+	"shopping-cart/money"
+	"shopping-cart/payment"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+// refundLineRequest asks for units of one order line to be refunded.
+type refundLineRequest struct {
+	ItemID   int `json:"item_id"`
+	Quantity int `json:"quantity"`
+}
+
+// refundRequest describes a refund. Without lines, everything left to refund
+// is refunded.
+type refundRequest struct {
+	Lines   []refundLineRequest `json:"lines"`
+	Restock bool                `json:"restock"`
+	Reason  string              `json:"reason"`
+}
+
+// refundError is returned when a refund can't be made as asked.
+type refundError struct {
+	Status  int
+	Message string
+	Details gin.H
+}
+
+func (e *refundError) Error() string {
+	return e.Message
+}
+
+func (e *refundError) response() gin.H {
+	body := gin.H{"error": e.Message}
+	for key, value := range e.Details {
+		body[key] = value
+	}
+	return body
+}
+
+// refundableStatuses are the statuses of orders that may be refunded. Orders
+// cancelled after payment are refunded in full when cancelled, and may only
+// be refunded again in full if that failed.
+var refundableStatuses = map[string]bool{
+	models.OrderStatusPaid:      true,
+	models.OrderStatusFulfilled: true,
+	models.OrderStatusShipped:   true,
+	models.OrderStatusDelivered: true,
+	models.OrderStatusCancelled: true,
+}
+
+// lineCharge is what the shopper paid for an order line: its total after
+// discount, plus its tax unless prices included it.
+func lineCharge(order models.Order, line models.OrderItem) money.Money {
+	charge := line.LineTotal.Sub(line.Discount)
+	if !order.TaxInclusive {
+		charge = charge.Add(line.Tax)
+	}
+	return charge
+}
+
+// refundedSoFar returns the amount of an order's refunds that haven't failed,
+// and the units of each order line they cover.
+func refundedSoFar(db *gorm.DB, orderID int) (money.Money, map[int]int, error) {
+	var refunds []models.Refund
+	if err := db.Where("order_id = ? AND status <> ?", orderID, models.RefundFailed).Find(&refunds).Error; err != nil {
+		return money.Money{}, nil, err
+	}
+
+	amount := money.Zero(money.DefaultCurrency)
+	refundIDs := []int{}
+	for _, refund := range refunds {
+		amount = amount.Add(refund.Amount)
+		refundIDs = append(refundIDs, refund.ID)
+	}
+
+	units := map[int]int{}
+	if len(refundIDs) == 0 {
+		return amount, units, nil
+	}
+	var lines []models.RefundLine
+	if err := db.Where("refund_id IN (?)", refundIDs).Find(&lines).Error; err != nil {
+		return money.Money{}, nil, err
+	}
+	for _, line := range lines {
+		units[line.OrderItemID] += line.Quantity
+	}
+	return amount, units, nil
+}
+
+// startRefund works out the refund req asks for and saves it as pending
+// within tx, so concurrent refunds can't together give back more than was
+// captured. It returns the refund and the capture it is made against.
+func startRefund(tx *gorm.DB, orderID int, req refundRequest, createdBy int) (models.Refund, models.Payment, error) {
+	var refund models.Refund
+
+	var order models.Order
+	if err := tx.First(&order, orderID).Error; err != nil {
+		return refund, models.Payment{}, err
+	}
+	if !refundableStatuses[order.Status] {
+		return refund, models.Payment{}, &refundError{
+			Status:  http.StatusConflict,
+			Message: "Order can't be refunded",
+			Details: gin.H{"current_status": order.Status},
+		}
+	}
+	if order.Status == models.OrderStatusCancelled && (len(req.Lines) > 0 || req.Restock) {
+		return refund, models.Payment{}, &refundError{
+			Status:  http.StatusConflict,
+			Message: "Cancelled orders can only be refunded in full, without restocking",
+		}
+	}
+
+	capture, ok, err := orderCapture(tx, order.ID)
+	if err != nil {
+		return refund, capture, err
+	}
+	if !ok {
+		return refund, capture, &refundError{Status: http.StatusConflict, Message: "Order has no captured payment to refund"}
+	}
+
+	refunded, refundedUnits, err := refundedSoFar(tx, order.ID)
+	if err != nil {
+		return refund, capture, err
+	}
+	remaining := capture.Amount.Sub(refunded)
+	if !remaining.IsPositive() {
+		return refund, capture, &refundError{Status: http.StatusConflict, Message: "Order has already been refunded in full"}
+	}
+
+	var orderLines []models.OrderItem
+	if err := tx.Where("order_id = ?", order.ID).Order("id").Find(&orderLines).Error; err != nil {
+		return refund, capture, err
+	}
+
+	refund = models.Refund{
+		OrderID:   order.ID,
+		Status:    models.RefundPending,
+		Amount:    money.Zero(remaining.Currency),
+		Reason:    req.Reason,
+		Restocked: req.Restock,
+		CreatedBy: createdBy,
+		Lines:     []models.RefundLine{},
+	}
+
+	if len(req.Lines) == 0 {
+		// Everything left, including shipping
+		for _, line := range orderLines {
+			done := refundedUnits[line.ID]
+			if done >= line.Quantity {
+				continue
+			}
+			charge := lineCharge(order, line)
+			refund.Lines = append(refund.Lines, models.RefundLine{
+				OrderItemID: line.ID,
+				ItemID:      line.ItemID,
+				Quantity:    line.Quantity - done,
+				Amount:      charge.Sub(charge.MulDiv(int64(done), int64(line.Quantity))),
+			})
+		}
+		refund.Amount = remaining
+	} else {
+		requested := map[int]bool{}
+		for _, want := range req.Lines {
+			var line *models.OrderItem
+			for i := range orderLines {
+				if orderLines[i].ItemID == want.ItemID {
+					line = &orderLines[i]
+				}
+			}
+			if line == nil || requested[want.ItemID] {
+				return refund, capture, &refundError{
+					Status:  http.StatusBadRequest,
+					Message: "Each refund line must name a different item on the order",
+					Details: gin.H{"item_id": want.ItemID},
+				}
+			}
+			requested[want.ItemID] = true
+
+			done := refundedUnits[line.ID]
+			if want.Quantity < 1 || want.Quantity > line.Quantity-done {
+				return refund, capture, &refundError{
+					Status:  http.StatusBadRequest,
+					Message: "Refund quantity must be between 1 and the units not yet refunded",
+					Details: gin.H{"item_id": want.ItemID, "refundable_quantity": line.Quantity - done},
+				}
+			}
+
+			// Priced on the units refunded so far, so refunding a line a unit
+			// at a time adds up to the whole line
+			charge := lineCharge(order, *line)
+			amount := charge.MulDiv(int64(done+want.Quantity), int64(line.Quantity)).
+				Sub(charge.MulDiv(int64(done), int64(line.Quantity)))
+			refund.Lines = append(refund.Lines, models.RefundLine{
+				OrderItemID: line.ID,
+				ItemID:      line.ItemID,
+				Quantity:    want.Quantity,
+				Amount:      amount,
+			})
+			refund.Amount = refund.Amount.Add(amount)
+			refundedUnits[line.ID] += want.Quantity
+		}
+
+		// Refunding the last units gives back the rest of the payment,
+		// shipping included
+		allRefunded := true
+		for _, line := range orderLines {
+			if refundedUnits[line.ID] < line.Quantity {
+				allRefunded = false
+			}
+		}
+		if allRefunded {
+			refund.Amount = remaining
+		}
+		refund.Amount = refund.Amount.Min(remaining)
+	}
+
+	if err := tx.Create(&refund).Error; err != nil {
+		return refund, capture, err
+	}
+	for i := range refund.Lines {
+		refund.Lines[i].RefundID = refund.ID
+		if err := tx.Create(&refund.Lines[i]).Error; err != nil {
+			return refund, capture, err
+		}
+	}
+	return refund, capture, nil
+}
+
+// finishRefund records the provider's answer to a pending refund within tx.
+// Refunds that are no longer pending, because they were settled some other
+// way meanwhile, are left alone and a *refundError is returned.
+// A successful refund restocks its units if asked and sets the order's refund
+// status. Refunding all of the payment also moves the order to refunded;
+// cancelled orders stay cancelled.
+func finishRefund(tx *gorm.DB, refund *models.Refund, record models.Payment, changedBy int) error {
+	refund.PaymentID = record.ID
+	refund.Reference = record.Reference
+	refund.Status = models.RefundSucceeded
+	if record.Status != models.PaymentSucceeded {
+		refund.Status = models.RefundFailed
+	}
+	result := tx.Model(refund).Where("status = ?", models.RefundPending).Updates(map[string]interface{}{
+		"status":     refund.Status,
+		"payment_id": refund.PaymentID,
+		"reference":  refund.Reference,
+	})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return &refundError{Status: http.StatusConflict, Message: "Refund has already been settled"}
+	}
+	if refund.Status != models.RefundSucceeded {
+		return nil
+	}
+
+	var order models.Order
+	if err := tx.First(&order, refund.OrderID).Error; err != nil {
+		return err
+	}
+
+	if refund.Restocked {
+		for _, line := range refund.Lines {
+			_, err := adjustStock(tx, models.StockAdjustment{
+				ItemID:  line.ItemID,
+				Delta:   line.Quantity,
+				Reason:  models.StockReasonRefund,
+				Note:    refund.Reason,
+				UserID:  changedBy,
+				OrderID: order.ID,
+			})
+			// Items deleted since checkout have nothing to restock
+			if err != nil && !errors.Is(err, errInsufficientStock) {
+				return err
+			}
+		}
+	}
+
+	capture, _, err := orderCapture(tx, order.ID)
+	if err != nil {
+		return err
+	}
+	refunded, _, err := refundedSoFar(tx, order.ID)
+	if err != nil {
+		return err
+	}
+	refundStatus := models.OrderRefundPartial
+	if refunded.Amount >= capture.Amount.Amount {
+		refundStatus = models.OrderRefundFull
+	}
+	if err := tx.Model(&order).Update("refund_status", refundStatus).Error; err != nil {
+		return err
+	}
+
+	// A partial refund leaves the order where it is in fulfilment
+	if refundStatus != models.OrderRefundFull || order.Status == models.OrderStatusCancelled {
+		return nil
+	}
+	return transitionOrder(tx, &order, models.OrderStatusRefunded, changedBy, refund.Reason)
+}
+
+// refundOrder refunds part or all of an order's payment through refunder.
+// The refund is reserved before the provider is asked and settled after, so
+// it is recorded as failed if the provider turns it down, and the returned
+// error is then a *paymentError. The provider's answer settles the refund
+// even if the payment recording it can't be saved. A refund that can't be
+// settled at all stays pending until settled with SettleRefund.
+func refundOrder(refunder payment.Refunder, orderID int, req refundRequest, changedBy int) (models.Refund, error) {
+	var refund models.Refund
+	var capture models.Payment
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		refund, capture, err = startRefund(tx, orderID, req, changedBy)
+		return err
+	})
+	if err != nil {
+		// Nothing was saved
+		return models.Refund{}, err
+	}
+
+	record, refundErr := refundCapture(refunder, orderID, capture.Reference, refund.Amount)
+	var failure *paymentError
+	if refundErr != nil && !errors.As(refundErr, &failure) {
+		log.Printf("Error recording refund %d for order %d: %v", refund.ID, orderID, refundErr)
+		refundErr = nil
+	}
+
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		return finishRefund(tx, &refund, record, changedBy)
+	})
+	if err != nil {
+		log.Printf("Error settling refund %d for order %d (provider %s, reference %q): %v",
+			refund.ID, orderID, record.Status, record.Reference, err)
+		return refund, err
+	}
+	return refund, refundErr
+}
+
+// refundCancelledOrder refunds whatever was captured for an order that was
+// cancelled, its stock having been put back by the cancellation. It returns
+// nil if the order was never paid.
+func refundCancelledOrder(order models.Order, reason string, cancelledBy int) (*models.Refund, error) {
+	_, ok, err := orderCapture(config.DB, order.ID)
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	if reason == "" {
+		reason = "Order cancelled"
+	}
+	refund, err := refundOrder(config.Payments, order.ID, refundRequest{Reason: reason}, cancelledBy)
+	if refund.ID == 0 {
+		return nil, err
+	}
+	return &refund, err
+}
+
+// refundErrorMessage describes why a refund wasn't made, for reporting with
+// an order that was cancelled regardless.
+func refundErrorMessage(err error) string {
+	var invalid *refundError
+	if errors.As(err, &invalid) {
+		return invalid.Message
+	}
+	var failure *paymentError
+	if errors.As(err, &failure) {
+		if failure.Status == http.StatusPaymentRequired {
+			return "Refund declined"
+		}
+		return failure.Message
+	}
+	return "Error refunding order"
+}
+
+// orderRefunds lists an order's refunds with their lines, oldest first.
+func orderRefunds(db *gorm.DB, orderID int) ([]models.Refund, error) {
+	refunds := []models.Refund{}
+	if err := db.Where("order_id = ?", orderID).Order("id").Find(&refunds).Error; err != nil {
+		return nil, err
+	}
+	if err := loadRefundLines(db, refunds); err != nil {
+		return nil, err
+	}
+	return refunds, nil
+}
+
+// loadRefundLines fills in the lines of each refund.
+func loadRefundLines(db *gorm.DB, refunds []models.Refund) error {
+	for i := range refunds {
+		refunds[i].Lines = []models.RefundLine{}
+		if err := db.Where("refund_id = ?", refunds[i].ID).Order("id").Find(&refunds[i].Lines).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateRefund refunds an order in full, or the units of the lines given,
+// e.g. {"lines": [{"item_id": 3, "quantity": 1}], "restock": true,
+// "reason": "Damaged in transit"}.
+func CreateRefund(c *gin.Context) {
+	order, ok := findOrderParam(c)
+	if !ok {
+		return
+	}
+
+	var req refundRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Reason == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A reason is required"})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	refund, err := refundOrder(config.Payments, order.ID, req, userID.(int))
+
+	var invalid *refundError
+	if errors.As(err, &invalid) {
+		c.JSON(invalid.Status, invalid.response())
+		return
+	}
+	var failure *paymentError
+	if errors.As(err, &failure) {
+		body := failure.response()
+		if failure.Status == http.StatusPaymentRequired {
+			body["error"] = "Refund declined"
+		}
+		body["refund"] = refund
+		c.JSON(failure.Status, body)
+		return
+	}
+	if err != nil {
+		body := gin.H{"error": "Error refunding order"}
+		// The refund was reserved but couldn't be settled, so it is left
+		// pending for SettleRefund
+		if refund.ID != 0 {
+			body["refund"] = refund
+		}
+		c.JSON(http.StatusInternalServerError, body)
+		return
+	}
+
+	if err := config.DB.First(&order, order.ID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching order"})
+		return
+	}
+	response, err := adminOrderResponse(order)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching order"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"refund": refund, "order": response})
+}
+
+// ListRefunds lists refunds across all orders, oldest first, e.g.
+// ?status=pending to find refunds left waiting on the provider's answer.
+func ListRefunds(c *gin.Context) {
+	params, err := parsePageParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := config.DB.Model(&models.Refund{})
+	if status := c.Query("status"); status != "" {
+		if status != models.RefundPending && status != models.RefundSucceeded && status != models.RefundFailed {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown refund status"})
+			return
+		}
+		query = query.Where("status = ?", status)
+	}
+
+	var total int
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error counting refunds"})
+		return
+	}
+
+	refunds := []models.Refund{}
+	if err := query.Order("id").Offset(params.Offset()).Limit(params.PageSize).Find(&refunds).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching refunds"})
+		return
+	}
+	if err := loadRefundLines(config.DB, refunds); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching refunds"})
+		return
+	}
+
+	c.JSON(http.StatusOK, pageResponse(refunds, params, total))
+}
+
+// SettleRefund settles a refund left pending, e.g. by a restart while the
+// provider was being asked, with the outcome the provider reports:
+// {"status": "succeeded", "reference": "re_123"} or {"status": "failed"}.
+func SettleRefund(c *gin.Context) {
+	refundID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid refund ID"})
+		return
+	}
+
+	var input struct {
+		Status    string `json:"status" binding:"required"`
+		Reference string `json:"reference"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	record := models.Payment{Reference: input.Reference}
+	switch input.Status {
+	case models.RefundSucceeded:
+		if input.Reference == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "The provider's reference is required for a succeeded refund"})
+			return
+		}
+		record.Status = models.PaymentSucceeded
+	case models.RefundFailed:
+		record.Status = models.PaymentFailed
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Status must be succeeded or failed"})
+		return
+	}
+
+	userID, _ := c.Get("user_id")
+	var refund models.Refund
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&refund, refundID).Error; err != nil {
+			return err
+		}
+		if refund.Status != models.RefundPending {
+			return &refundError{
+				Status:  http.StatusConflict,
+				Message: "Only pending refunds can be settled",
+				Details: gin.H{"current_status": refund.Status},
+			}
+		}
+		refund.Lines = []models.RefundLine{}
+		if err := tx.Where("refund_id = ?", refund.ID).Order("id").Find(&refund.Lines).Error; err != nil {
+			return err
+		}
+		return finishRefund(tx, &refund, record, userID.(int))
+	})
+
+	if gorm.IsRecordNotFoundError(err) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Refund not found"})
+		return
+	}
+	var invalid *refundError
+	if errors.As(err, &invalid) {
+		c.JSON(invalid.Status, invalid.response())
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error settling refund"})
+		return
+	}
+
+	var order models.Order
+	if err := config.DB.First(&order, refund.OrderID).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching order"})
+		return
+	}
+	response, err := adminOrderResponse(order)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching order"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"refund": refund, "order": response})
+}
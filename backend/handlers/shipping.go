@@ -0,0 +1,157 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"shopping-cart/config"
+	"shopping-cart/models"
+	"shopping-cart/money"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+// loadRegionRates fills in the method's region rates.
+func loadRegionRates(db *gorm.DB, method *models.ShippingMethod) error {
+	method.RegionRates = []models.ShippingRegionRate{}
+	return db.Where("method_id = ?", method.ID).Order("region").Find(&method.RegionRates).Error
+}
+
+// loadShippingMethods returns the shipping methods with their region rates,
+// only the active ones unless all is set.
+func loadShippingMethods(db *gorm.DB, all bool) ([]models.ShippingMethod, error) {
+	query := db.Order("id")
+	if !all {
+		query = query.Where("active = ?", true)
+	}
+
+	methods := []models.ShippingMethod{}
+	if err := query.Find(&methods).Error; err != nil {
+		return nil, err
+	}
+	for i := range methods {
+		if err := loadRegionRates(db, &methods[i]); err != nil {
+			return nil, err
+		}
+	}
+	return methods, nil
+}
+
+// chargeableWeight is the weight shipping is charged for: each line's units
+// at their shipping weight. items are the catalogue items of lines.
+func chargeableWeight(items []models.Item, lines []models.OrderItem) int {
+	weight := 0
+	for i, line := range lines {
+		weight += items[i].ShippingWeightGrams() * line.Quantity
+	}
+	return weight
+}
+
+// quoteShipping prices sending weightGrams of merchandise worth value to
+// region by method. It reports false if the method doesn't deliver there or
+// can't carry the weight.
+func quoteShipping(method models.ShippingMethod, region string, weightGrams int, value money.Money, freeShipping bool) (money.Money, bool) {
+	if !method.Active || !method.AvailableIn(region) {
+		return money.Money{}, false
+	}
+	if method.MaxWeightGrams > 0 && weightGrams > method.MaxWeightGrams {
+		return money.Money{}, false
+	}
+	if freeShipping || (method.FreeOver.IsPositive() && value.Amount >= method.FreeOver.Amount) {
+		return money.Zero(money.DefaultCurrency), true
+	}
+
+	base, perKg := method.RatesFor(region)
+	startedKg := (weightGrams + 999) / 1000
+	return base.Add(perKg.Mul(startedKg)), true
+}
+
+// GetShippingOptions quotes every shipping method available for the user's
+// active cart, sent to the address given by the address_id query parameter
+// or their default address.
+func GetShippingOptions(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var cart models.Cart
+	if err := config.DB.Where("user_id = ? AND status = ?", userID, models.CartStatusActive).First(&cart).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "No active cart found"})
+		return
+	}
+
+	addressID := 0
+	if raw := c.Query("address_id"); raw != "" {
+		var err error
+		if addressID, err = strconv.Atoi(raw); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid address ID"})
+			return
+		}
+	}
+	// The same lookup checkout uses, so the quote is for the same address
+	address, err := shippingAddress(config.DB, cart.UserID, addressID)
+	var failure *checkoutError
+	if errors.As(err, &failure) && failure.Status != http.StatusInternalServerError {
+		c.JSON(failure.Status, gin.H{"error": failure.Message})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching address"})
+		return
+	}
+
+	items, lines, _, err := loadCartLines(config.DB, cart.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching cart items"})
+		return
+	}
+	if len(lines) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cart is empty"})
+		return
+	}
+
+	applied, err := applyCartCoupon(config.DB, cart, lines)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error applying coupon"})
+		return
+	}
+	region := address.TaxRegion()
+	totals, err := calculateTotals(lines, region)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error calculating tax"})
+		return
+	}
+
+	methods, err := loadShippingMethods(config.DB, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching shipping methods"})
+		return
+	}
+
+	weight := chargeableWeight(items, lines)
+	options := []gin.H{}
+	for _, method := range methods {
+		cost, ok := quoteShipping(method, region, weight, totals.Subtotal.Sub(totals.Discount), applied.freeShipping())
+		if !ok {
+			continue
+		}
+		options = append(options, gin.H{
+			"code":     method.Code,
+			"name":     method.Name,
+			"cost":     cost,
+			"min_days": method.MinDays,
+			"max_days": method.MaxDays,
+			"total":    totals.Total.Add(cost),
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"address_id":   address.ID,
+		"region":       region,
+		"weight_grams": weight,
+		"options":      options,
+	})
+}
@@ -1,11 +1,15 @@
 package handlers
 
 import (
+	"errors"
+	"log"
 	"net/http"
+	"shopping-cart/auth"
 	"shopping-cart/config"
 	"shopping-cart/models"
 
 	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -39,12 +43,28 @@ func SignUp(c *gin.Context) {
 	user := models.User{
 		Username: input.Username,
 		Password: hashedPassword,
+		Role:     models.RoleCustomer,
 	}
 
-	if err := config.DB.Create(&user).Error; err != nil {
+	var taken bool
+	err = config.DB.Transaction(func(tx *gorm.DB) error {
+		var count int
+		if err := tx.Model(&models.User{}).Where("username = ?", user.Username).Count(&count).Error; err != nil {
+			return err
+		}
+		if taken = count > 0; taken {
+			return nil
+		}
+		return tx.Create(&user).Error
+	})
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating user"})
 		return
 	}
+	if taken {
+		c.JSON(http.StatusConflict, gin.H{"error": "Username is already taken"})
+		return
+	}
 
 	c.JSON(http.StatusCreated, gin.H{"id": user.ID, "username": user.Username})
 }
@@ -71,13 +91,97 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	user.Token = "sample-token"
+	pair, err := auth.StartSession(user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error issuing token"})
+		return
+	}
 
-	c.JSON(http.StatusOK, gin.H{
-		"token": user.Token,
-		"user": gin.H{
-			"id":       user.ID,
-			"username": user.Username,
-		},
-	})
+	response := tokenPairResponse(pair)
+	response["user"] = gin.H{
+		"id":       user.ID,
+		"username": user.Username,
+		"role":     user.Role,
+	}
+
+	// A guest cart the shopper built before signing in joins their cart
+	if token := cartTokenFromRequest(c); token != "" {
+		merge, err := mergeGuestCartOnLogin(token, user.ID)
+		if err != nil {
+			log.Printf("Error merging guest cart for user %d: %v", user.ID, err)
+		} else if merge != nil {
+			response["cart_merge"] = merge
+		}
+		clearCartToken(c)
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+func RefreshToken(c *gin.Context) {
+	var input struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	pair, err := auth.RotateRefreshToken(input.RefreshToken)
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrRefreshTokenExpired):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token has expired", "code": "refresh_token_expired"})
+		case errors.Is(err, auth.ErrRefreshTokenReused):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Refresh token has already been used, session revoked", "code": "refresh_token_reused"})
+		case errors.Is(err, auth.ErrSessionRevoked):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Session has been revoked", "code": "session_revoked"})
+		case errors.Is(err, auth.ErrRefreshTokenInvalid):
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid refresh token", "code": "refresh_token_invalid"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error refreshing token"})
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, tokenPairResponse(pair))
+}
+
+func Logout(c *gin.Context) {
+	sessionID, exists := c.Get("session_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	if err := auth.RevokeSession(sessionID.(int)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error logging out"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
+}
+
+func LogoutAll(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	if err := auth.RevokeAllSessions(userID.(int)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error logging out"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Logged out of all devices successfully"})
+}
+
+func tokenPairResponse(pair *auth.TokenPair) gin.H {
+	return gin.H{
+		"token":              pair.AccessToken,
+		"expires_at":         pair.AccessExpiresAt,
+		"refresh_token":      pair.RefreshToken,
+		"refresh_expires_at": pair.RefreshExpiresAt,
+	}
 }
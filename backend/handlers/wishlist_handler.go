@@ -0,0 +1,511 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"shopping-cart/auth"
+	"shopping-cart/config"
+	"shopping-cart/models"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+)
+
+// wishlistNameTaken reports whether another of the user's wishlists already
+// uses wishlist's name.
+func wishlistNameTaken(db *gorm.DB, wishlist models.Wishlist) (bool, error) {
+	var count int
+	err := db.Model(&models.Wishlist{}).
+		Where("user_id = ? AND name = ? AND id <> ?", wishlist.UserID, wishlist.Name, wishlist.ID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+// findWishlistParam loads the wishlist named in the URL. Wishlists belonging
+// to someone else are reported as not found.
+func findWishlistParam(c *gin.Context, userID int) (models.Wishlist, bool) {
+	var wishlist models.Wishlist
+	wishlistID, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid wishlist ID"})
+		return wishlist, false
+	}
+
+	if err := config.DB.Where("id = ? AND user_id = ?", wishlistID, userID).First(&wishlist).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Wishlist not found"})
+		return wishlist, false
+	}
+	return wishlist, true
+}
+
+// wishlistEntry describes an item on a wishlist, pointing out a price drop
+// and whether it went out of stock since it was added.
+func wishlistEntry(entry models.WishlistItem, item models.Item) gin.H {
+	inStock := item.Status == models.ItemStatusActive && item.Stock > 0
+	priceDropped := item.Price.Currency == entry.AddedPrice.Currency && item.Price.Amount < entry.AddedPrice.Amount
+
+	described := gin.H{
+		"item_id":           item.ID,
+		"name":              item.Name,
+		"brand":             item.Brand,
+		"category":          item.Category,
+		"image_urls":        item.ImageURLs,
+		"price":             item.Price,
+		"added_price":       entry.AddedPrice,
+		"added_at":          entry.CreatedAt,
+		"in_stock":          inStock,
+		"price_dropped":     priceDropped,
+		"went_out_of_stock": entry.AddedInStock && !inStock,
+	}
+	if priceDropped {
+		described["price_drop"] = entry.AddedPrice.Sub(item.Price)
+	}
+	return described
+}
+
+// wishlistEntries describes the items on a wishlist, oldest first. Items
+// that no longer exist are left out.
+func wishlistEntries(db *gorm.DB, wishlistID int) ([]gin.H, error) {
+	var entries []models.WishlistItem
+	if err := db.Where("wishlist_id = ?", wishlistID).Order("created_at, item_id").Find(&entries).Error; err != nil {
+		return nil, err
+	}
+
+	described := []gin.H{}
+	for _, entry := range entries {
+		var item models.Item
+		if err := db.First(&item, entry.ItemID).Error; err != nil {
+			if gorm.IsRecordNotFoundError(err) {
+				continue
+			}
+			return nil, err
+		}
+		described = append(described, wishlistEntry(entry, item))
+	}
+	return described, nil
+}
+
+// wishlistResponse renders a wishlist for its owner, with its items if
+// withItems is set or a count of them otherwise.
+func wishlistResponse(db *gorm.DB, wishlist models.Wishlist, withItems bool) (gin.H, error) {
+	response := gin.H{
+		"id":         wishlist.ID,
+		"name":       wishlist.Name,
+		"shared":     wishlist.Shared(),
+		"created_at": wishlist.CreatedAt,
+	}
+	if !withItems {
+		var count int
+		err := db.Model(&models.WishlistItem{}).Where("wishlist_id = ?", wishlist.ID).Count(&count).Error
+		response["item_count"] = count
+		return response, err
+	}
+
+	entries, err := wishlistEntries(db, wishlist.ID)
+	response["items"] = entries
+	return response, err
+}
+
+// respondWishlist renders the wishlist with its items.
+func respondWishlist(c *gin.Context, status int, wishlist models.Wishlist) {
+	response, err := wishlistResponse(config.DB, wishlist, true)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching wishlist items"})
+		return
+	}
+	c.JSON(status, response)
+}
+
+// ListWishlists returns the user's wishlists with how many items each holds.
+func ListWishlists(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var wishlists []models.Wishlist
+	if err := config.DB.Where("user_id = ?", userID).Order("id").Find(&wishlists).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching wishlists"})
+		return
+	}
+
+	responses := []gin.H{}
+	for _, wishlist := range wishlists {
+		response, err := wishlistResponse(config.DB, wishlist, false)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching wishlists"})
+			return
+		}
+		responses = append(responses, response)
+	}
+
+	c.JSON(http.StatusOK, responses)
+}
+
+func GetWishlist(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	wishlist, ok := findWishlistParam(c, userID.(int))
+	if !ok {
+		return
+	}
+
+	respondWishlist(c, http.StatusOK, wishlist)
+}
+
+// CreateWishlist starts a wishlist with {"name": "Birthday"}.
+func CreateWishlist(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	var input struct {
+		Name string `json:"name"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	wishlist := models.Wishlist{
+		UserID: userID.(int),
+		Name:   strings.TrimSpace(input.Name),
+	}
+	if msg := validateListName(wishlist.Name); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	var taken bool
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if taken, err = wishlistNameTaken(tx, wishlist); err != nil || taken {
+			return err
+		}
+		return tx.Create(&wishlist).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error creating wishlist"})
+		return
+	}
+	if taken {
+		c.JSON(http.StatusConflict, gin.H{"error": "You already have a wishlist with that name"})
+		return
+	}
+
+	respondWishlist(c, http.StatusCreated, wishlist)
+}
+
+// RenameWishlist renames one of the user's wishlists with {"name": "..."}.
+func RenameWishlist(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	wishlist, ok := findWishlistParam(c, userID.(int))
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Name string `json:"name"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	wishlist.Name = strings.TrimSpace(input.Name)
+	if msg := validateListName(wishlist.Name); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	var taken bool
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		if taken, err = wishlistNameTaken(tx, wishlist); err != nil || taken {
+			return err
+		}
+		return tx.Model(&wishlist).Update("name", wishlist.Name).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating wishlist"})
+		return
+	}
+	if taken {
+		c.JSON(http.StatusConflict, gin.H{"error": "You already have a wishlist with that name"})
+		return
+	}
+
+	respondWishlist(c, http.StatusOK, wishlist)
+}
+
+// DeleteWishlist removes a wishlist and its items; its share link stops
+// working.
+func DeleteWishlist(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	wishlist, ok := findWishlistParam(c, userID.(int))
+	if !ok {
+		return
+	}
+
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("wishlist_id = ?", wishlist.ID).Delete(&models.WishlistItem{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&wishlist).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error deleting wishlist"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Wishlist deleted successfully"})
+}
+
+// AddWishlistItem adds {"item_id": n} to a wishlist, noting its current price
+// and stock. Adding an item already on the wishlist leaves it as it was.
+func AddWishlistItem(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	wishlist, ok := findWishlistParam(c, userID.(int))
+	if !ok {
+		return
+	}
+
+	var input struct {
+		ItemID int `json:"item_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	item, err := findItemOnSale(config.DB, input.ItemID)
+	if errors.Is(err, errItemNotOnSale) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching item"})
+		return
+	}
+
+	// Concurrent adds of the same item keep the first
+	result := config.DB.Exec(`INSERT INTO wishlist_items
+		(wishlist_id, item_id, added_price_amount, added_price_currency, added_in_stock, created_at)
+		VALUES (?, ?, ?, ?, ?, ?) ON CONFLICT (wishlist_id, item_id) DO NOTHING`,
+		wishlist.ID, item.ID, item.Price.Amount, item.Price.Currency, item.Stock > 0, time.Now())
+	var entry models.WishlistItem
+	if result.Error == nil {
+		result.Error = config.DB.Where("wishlist_id = ? AND item_id = ?", wishlist.ID, item.ID).First(&entry).Error
+	}
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error adding item to wishlist"})
+		return
+	}
+
+	status := http.StatusOK
+	if result.RowsAffected > 0 {
+		status = http.StatusCreated
+	}
+	c.JSON(status, wishlistEntry(entry, item))
+}
+
+func RemoveWishlistItem(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	wishlist, ok := findWishlistParam(c, userID.(int))
+	if !ok {
+		return
+	}
+
+	itemID, err := strconv.Atoi(c.Param("item_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item ID"})
+		return
+	}
+
+	result := config.DB.Where("wishlist_id = ? AND item_id = ?", wishlist.ID, itemID).Delete(&models.WishlistItem{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error removing item from wishlist"})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item not on wishlist"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Item removed from wishlist successfully"})
+}
+
+// ShareWishlist gives a wishlist a new share link, returning its token once.
+// Any earlier link stops working.
+func ShareWishlist(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	wishlist, ok := findWishlistParam(c, userID.(int))
+	if !ok {
+		return
+	}
+
+	token, hash, err := auth.NewShareToken()
+	if err == nil {
+		err = config.DB.Model(&wishlist).Update("share_token_hash", hash).Error
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error sharing wishlist"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"share_token": token,
+		"share_path":  "/wishlists/shared/" + token,
+	})
+}
+
+// UnshareWishlist turns off a wishlist's share link.
+func UnshareWishlist(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	wishlist, ok := findWishlistParam(c, userID.(int))
+	if !ok {
+		return
+	}
+
+	if err := config.DB.Model(&wishlist).Update("share_token_hash", "").Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error updating wishlist"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Wishlist is no longer shared"})
+}
+
+// GetSharedWishlist shows a shared wishlist to anyone with its share token,
+// without saying whose it is.
+func GetSharedWishlist(c *gin.Context) {
+	var wishlist models.Wishlist
+	err := config.DB.Where("share_token_hash = ?", auth.HashShareToken(c.Param("token"))).First(&wishlist).Error
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Wishlist not found"})
+		return
+	}
+
+	entries, err := wishlistEntries(config.DB, wishlist.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error fetching wishlist items"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"name":  wishlist.Name,
+		"items": entries,
+	})
+}
+
+// MoveWishlistToCart adds one unit of each item on a wishlist to the user's
+// active cart, checked the way AddToCart checks them. Items added are taken
+// off the wishlist; the rest stay on it and are reported as skipped.
+func MoveWishlistToCart(c *gin.Context) {
+	userID, exists := c.Get("user_id")
+	if !exists {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not authenticated"})
+		return
+	}
+
+	wishlist, ok := findWishlistParam(c, userID.(int))
+	if !ok {
+		return
+	}
+
+	var result cartCopyResult
+	err := config.DB.Transaction(func(tx *gorm.DB) error {
+		owner := cartOwner{UserID: wishlist.UserID}
+		cart, err := activeCart(tx, owner)
+		if gorm.IsRecordNotFoundError(err) {
+			cart, _, err = createActiveCart(tx, owner)
+		}
+		if err != nil {
+			return err
+		}
+		result = newCartCopyResult(cart.ID)
+
+		var entries []models.WishlistItem
+		if err := tx.Where("wishlist_id = ?", wishlist.ID).Order("created_at, item_id").Find(&entries).Error; err != nil {
+			return err
+		}
+
+		for _, entry := range entries {
+			outcome := lineOutcome{ItemID: entry.ItemID, Requested: 1}
+
+			item, err := findItemOnSale(tx, entry.ItemID)
+			if err == nil {
+				outcome.Quantity, err = addItemToCart(tx, cart.ID, item, 1)
+			}
+			switch {
+			case errors.Is(err, errItemNotOnSale):
+				outcome.Reason = reasonUnavailable
+			case errors.Is(err, errMaxPerItem):
+				outcome.Reason = reasonLineLimit
+			case errors.Is(err, errNotEnoughStock) && outcome.Quantity > 0:
+				// The units in stock are all in the cart already
+				outcome.Reason = reasonCartHolds
+			case errors.Is(err, errNotEnoughStock):
+				outcome.Reason = reasonOutOfStock
+			case err != nil:
+				return err
+			}
+			if outcome.Reason != "" {
+				result.Skipped = append(result.Skipped, outcome)
+				continue
+			}
+
+			if err := tx.Where("wishlist_id = ? AND item_id = ?", entry.WishlistID, entry.ItemID).
+				Delete(&models.WishlistItem{}).Error; err != nil {
+				return err
+			}
+			result.Added = append(result.Added, outcome)
+		}
+		return nil
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error moving wishlist to cart"})
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
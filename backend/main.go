@@ -2,6 +2,7 @@ package main
 
 import (
 	"log"
+	"shopping-cart/auth"
 	"shopping-cart/config"
 	"shopping-cart/handlers"
 	"shopping-cart/middleware"
@@ -10,18 +11,43 @@ import (
 )
 
 func main() {
+	if err := config.LoadAuthConfig(); err != nil {
+		log.Fatal("Failed to load auth configuration:", err)
+	}
+
+	if err := config.LoadTaxConfig(); err != nil {
+		log.Fatal("Failed to load tax configuration:", err)
+	}
+
+	if err := config.LoadPaymentConfig(); err != nil {
+		log.Fatal("Failed to load payment configuration:", err)
+	}
+
+	if err := config.LoadCartConfig(); err != nil {
+		log.Fatal("Failed to load cart configuration:", err)
+	}
+
+	if err := config.LoadIdempotencyConfig(); err != nil {
+		log.Fatal("Failed to load idempotency configuration:", err)
+	}
+
 	if err := config.InitDB(); err != nil {
 		log.Fatal("Failed to initialize database:", err)
 	}
 	defer config.DB.Close()
 
+	if err := config.InitSearch(); err != nil {
+		log.Fatal("Failed to initialize search index:", err)
+	}
+
 	r := gin.Default()
 
 	// Enable CORS
 	r.Use(func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
-		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, Idempotency-Key, "+auth.CartTokenHeader)
+		c.Writer.Header().Set("Access-Control-Expose-Headers", auth.CartTokenHeader)
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
 			return
@@ -32,22 +58,133 @@ func main() {
 	// Public routes
 	r.POST("/users", handlers.SignUp)
 	r.POST("/users/login", handlers.Login)
+	r.POST("/users/refresh", handlers.RefreshToken)
 	r.GET("/items", handlers.GetItems)
+	r.GET("/items/search", handlers.SearchItems)
 	r.GET("/items/:id", handlers.GetItem)
+	r.GET("/wishlists/shared/:token", handlers.GetSharedWishlist)
+
+	// Cart routes, open to guests identified by their cart token
+	carts := r.Group("/carts")
+	carts.Use(middleware.OptionalAuth())
+	{
+		carts.POST("", middleware.Idempotency(), handlers.AddToCart)
+		carts.GET("/me", handlers.GetUserCart)
+		carts.DELETE("/items", handlers.DeleteCartItem)
+		carts.PUT("/items/:item_id", handlers.UpdateCartItem)
+		carts.PATCH("/items/:item_id", handlers.UpdateCartItem)
+	}
 
 	// Protected routes
 	protected := r.Group("/")
 	protected.Use(middleware.AuthMiddleware())
 	{
+		// Session routes
+		protected.POST("/users/logout", handlers.Logout)
+		protected.POST("/users/logout-all", handlers.LogoutAll)
+
+		// Address book routes
+		protected.GET("/users/me/addresses", handlers.ListAddresses)
+		protected.POST("/users/me/addresses", handlers.CreateAddress)
+		protected.GET("/users/me/addresses/:id", handlers.GetAddress)
+		protected.PUT("/users/me/addresses/:id", handlers.UpdateAddress)
+		protected.DELETE("/users/me/addresses/:id", handlers.DeleteAddress)
+		protected.POST("/users/me/addresses/:id/default", handlers.SetDefaultAddress)
+
 		// Cart routes
-		protected.POST("/carts", handlers.AddToCart)
-		protected.GET("/carts/me", handlers.GetUserCart)
-		protected.POST("/carts/cleanup", handlers.CleanupCart)
-		protected.DELETE("/carts/items", handlers.DeleteCartItem)
+		protected.GET("/carts/me/shipping-options", handlers.GetShippingOptions)
+		protected.GET("/carts/saved", handlers.GetSavedForLater)
+		protected.POST("/carts/items/:item_id/save-for-later", handlers.SaveForLater)
+		protected.POST("/carts/saved/:item_id/move-to-cart", handlers.MoveToCart)
+
+		// Named cart routes
+		protected.GET("/users/me/carts", handlers.ListCarts)
+		protected.POST("/users/me/carts", handlers.CreateCart)
+		protected.GET("/users/me/carts/:id", handlers.GetCart)
+		protected.PATCH("/users/me/carts/:id", handlers.RenameCart)
+		protected.DELETE("/users/me/carts/:id", handlers.DeleteCart)
+		protected.POST("/users/me/carts/:id/activate", handlers.ActivateCart)
+		protected.POST("/users/me/carts/:id/items/:item_id/move", handlers.MoveCartItem)
+
+		// Wishlist routes
+		protected.GET("/users/me/wishlists", handlers.ListWishlists)
+		protected.POST("/users/me/wishlists", handlers.CreateWishlist)
+		protected.GET("/users/me/wishlists/:id", handlers.GetWishlist)
+		protected.PATCH("/users/me/wishlists/:id", handlers.RenameWishlist)
+		protected.DELETE("/users/me/wishlists/:id", handlers.DeleteWishlist)
+		protected.POST("/users/me/wishlists/:id/items", handlers.AddWishlistItem)
+		protected.DELETE("/users/me/wishlists/:id/items/:item_id", handlers.RemoveWishlistItem)
+		protected.POST("/users/me/wishlists/:id/share", handlers.ShareWishlist)
+		protected.DELETE("/users/me/wishlists/:id/share", handlers.UnshareWishlist)
+		protected.POST("/users/me/wishlists/:id/move-to-cart", handlers.MoveWishlistToCart)
+		protected.POST("/carts/coupon", handlers.ApplyCoupon)
+		protected.DELETE("/carts/coupon", handlers.RemoveCoupon)
 
 		// Order routes
-		protected.POST("/orders", handlers.CreateOrder)
+		protected.POST("/orders", middleware.Idempotency(), handlers.CreateOrder)
 		protected.GET("/orders/me", handlers.GetUserOrders)
+		protected.POST("/orders/:id/cancel", handlers.CancelOrder)
+		protected.POST("/orders/:id/pay", middleware.Idempotency(), handlers.PayOrder)
+		protected.POST("/orders/:id/reorder", middleware.Idempotency(), handlers.ReorderOrder)
+	}
+
+	// Admin routes, each group guarded by the permission it needs
+	admin := r.Group("/admin")
+	admin.Use(middleware.AuthMiddleware())
+
+	adminCatalogue := admin.Group("/items")
+	adminCatalogue.Use(middleware.RequirePermission(auth.PermManageCatalogue))
+	{
+		adminCatalogue.GET("", handlers.ListAllItems)
+		adminCatalogue.POST("", handlers.CreateItem)
+		adminCatalogue.PUT("/:id", handlers.UpdateItem)
+		adminCatalogue.PATCH("/:id", handlers.PatchItem)
+		adminCatalogue.POST("/:id/archive", handlers.ArchiveItem)
+		adminCatalogue.DELETE("/:id", handlers.DeleteItem)
+		adminCatalogue.GET("/:id/stock", handlers.GetItemStockAdjustments)
+		adminCatalogue.POST("/:id/stock", handlers.AdjustItemStock)
+	}
+
+	adminOrders := admin.Group("/orders")
+	adminOrders.Use(middleware.RequirePermission(auth.PermManageOrders))
+	{
+		adminOrders.GET("", handlers.ListOrders)
+		adminOrders.GET("/:id", handlers.GetOrder)
+		adminOrders.POST("/:id/status", handlers.UpdateOrderStatus)
+		adminOrders.POST("/:id/refunds", handlers.CreateRefund)
+	}
+
+	adminRefunds := admin.Group("/refunds")
+	adminRefunds.Use(middleware.RequirePermission(auth.PermManageOrders))
+	{
+		adminRefunds.GET("", handlers.ListRefunds)
+		adminRefunds.POST("/:id/settle", handlers.SettleRefund)
+	}
+
+	adminCoupons := admin.Group("/coupons")
+	adminCoupons.Use(middleware.RequirePermission(auth.PermManagePromotions))
+	{
+		adminCoupons.GET("", handlers.ListCoupons)
+		adminCoupons.POST("", handlers.CreateCoupon)
+		adminCoupons.GET("/:id", handlers.GetCoupon)
+		adminCoupons.PATCH("/:id", handlers.UpdateCoupon)
+		adminCoupons.DELETE("/:id", handlers.DeleteCoupon)
+	}
+
+	adminShipping := admin.Group("/shipping-methods")
+	adminShipping.Use(middleware.RequirePermission(auth.PermManageShipping))
+	{
+		adminShipping.GET("", handlers.ListShippingMethods)
+		adminShipping.POST("", handlers.CreateShippingMethod)
+		adminShipping.PATCH("/:id", handlers.UpdateShippingMethod)
+		adminShipping.DELETE("/:id", handlers.DeleteShippingMethod)
+	}
+
+	adminUsers := admin.Group("/users")
+	adminUsers.Use(middleware.RequirePermission(auth.PermManageUsers))
+	{
+		adminUsers.GET("", handlers.ListUsers)
+		adminUsers.PUT("/:id/role", handlers.UpdateUserRole)
 	}
 
 	r.Run(":8080")
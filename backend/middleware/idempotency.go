@@ -0,0 +1,192 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"shopping-cart/auth"
+	"shopping-cart/config"
+	"shopping-cart/models"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const idempotencyHeader = "Idempotency-Key"
+
+// replayedHeaders are the response headers stored with a key and sent again
+// on replay, so a guest who retries the request that started their cart
+// still gets its token.
+var replayedHeaders = []string{auth.CartTokenHeader, "Set-Cookie"}
+
+// responseRecorder copies everything written to the client so it can be
+// stored for replay.
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// idempotencyOwner returns who a request's key belongs to: the signed-in user,
+// or a guest's cart token hash. A guest without a cart token yet is
+// identified by their client, the address and user agent they send from.
+func idempotencyOwner(c *gin.Context) (userID int, cartTokenHash string) {
+	if id, authenticated := c.Get("user_id"); authenticated {
+		return id.(int), ""
+	}
+	token := c.GetHeader(auth.CartTokenHeader)
+	if token == "" {
+		token, _ = c.Cookie(auth.CartTokenCookie)
+	}
+	if token != "" {
+		return 0, auth.HashCartToken(token)
+	}
+	client := sha256.Sum256([]byte(c.ClientIP() + "\n" + c.Request.UserAgent()))
+	return 0, "client:" + hex.EncodeToString(client[:])
+}
+
+// Idempotency makes a mutating route safe to retry. When a request carries an
+// Idempotency-Key header, the first response for that key is stored per user,
+// or per cart token for guests, and replayed for repeats within
+// config.IdempotencyKeyTTL. Reusing a key with a different request returns
+// 422. It must run after AuthMiddleware or OptionalAuth; requests without a
+// key pass straight through.
+func Idempotency() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(idempotencyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+
+		if len(key) > 255 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key must be at most 255 characters"})
+			c.Abort()
+			return
+		}
+
+		userID, cartTokenHash := idempotencyOwner(c)
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Error reading request body"})
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		requestHash := hashRequest(c.Request.Method, c.Request.URL.RequestURI(), body)
+
+		cutoff := time.Now().Add(-config.IdempotencyKeyTTL)
+		config.DB.Where("created_at < ?", cutoff).Delete(&models.IdempotencyKey{})
+
+		record := models.IdempotencyKey{
+			UserID:        userID,
+			CartTokenHash: cartTokenHash,
+			Key:           key,
+			RequestHash:   requestHash,
+		}
+		// The unique index on (user_id, cart_token_hash, key) lets exactly one
+		// request claim it
+		if err := config.DB.Create(&record).Error; err != nil {
+			replayIdempotent(c, record, requestHash)
+			return
+		}
+
+		// A handler that panics leaves no response to store, so the key is
+		// released for a retry before the panic carries on to Recovery
+		defer func() {
+			if r := recover(); r != nil {
+				config.DB.Delete(&record)
+				panic(r)
+			}
+		}()
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		// Server errors are not stored, so the client can retry with the same key
+		if recorder.Status() >= http.StatusInternalServerError {
+			config.DB.Delete(&record)
+			return
+		}
+
+		headers := map[string][]string{}
+		for _, name := range replayedHeaders {
+			if values := recorder.Header().Values(name); len(values) > 0 {
+				headers[name] = values
+			}
+		}
+		encodedHeaders, _ := json.Marshal(headers)
+
+		config.DB.Model(&record).Updates(map[string]interface{}{
+			"completed":        true,
+			"status_code":      recorder.Status(),
+			"content_type":     recorder.Header().Get("Content-Type"),
+			"response_body":    recorder.body.String(),
+			"response_headers": string(encodedHeaders),
+		})
+	}
+}
+
+// replayIdempotent answers a request whose key was already claimed by the
+// same owner.
+func replayIdempotent(c *gin.Context, claim models.IdempotencyKey, requestHash string) {
+	var record models.IdempotencyKey
+	if err := config.DB.Where("user_id = ? AND cart_token_hash = ? AND key = ?",
+		claim.UserID, claim.CartTokenHash, claim.Key).First(&record).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking idempotency key"})
+		c.Abort()
+		return
+	}
+
+	if record.RequestHash != requestHash {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key was already used for a different request"})
+		c.Abort()
+		return
+	}
+
+	if !record.Completed {
+		c.JSON(http.StatusConflict, gin.H{"error": "A request with this Idempotency-Key is still in progress"})
+		c.Abort()
+		return
+	}
+
+	var headers map[string][]string
+	if record.ResponseHeaders != "" {
+		if err := json.Unmarshal([]byte(record.ResponseHeaders), &headers); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Error checking idempotency key"})
+			c.Abort()
+			return
+		}
+	}
+	for name, values := range headers {
+		for _, value := range values {
+			c.Writer.Header().Add(name, value)
+		}
+	}
+	c.Header("Idempotent-Replayed", "true")
+	c.Data(record.StatusCode, record.ContentType, []byte(record.ResponseBody))
+	c.Abort()
+}
+
+// hashRequest identifies a request by its method, the path and query it was
+// sent to, and its body, so one key can't be replayed for another resource.
+func hashRequest(method, uri string, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(method + " " + uri + "\n"))
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
+}
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"regexp"
+	"time"
+)
+
+// PostalAddress is where an order ships to. Country is an ISO 3166-1 alpha-2
+// code and Region the state or province code within it.
+type PostalAddress struct {
+	Name       string `json:"name" gorm:"type:varchar"`
+	Line1      string `json:"line1" gorm:"type:varchar"`
+	Line2      string `json:"line2" gorm:"type:varchar"`
+	City       string `json:"city" gorm:"type:varchar"`
+	Region     string `json:"region" gorm:"type:varchar"`
+	PostalCode string `json:"postal_code" gorm:"type:varchar"`
+	Country    string `json:"country" gorm:"type:varchar(2)"`
+	Phone      string `json:"phone" gorm:"type:varchar"`
+}
+
+// TaxRegion returns the region the address is taxed in, e.g. "US-CA", or
+// just the country where it has no region.
+func (a PostalAddress) TaxRegion() string {
+	if a.Region == "" {
+		return a.Country
+	}
+	return a.Country + "-" + a.Region
+}
+
+// Address is an entry in a user's address book.
+type Address struct {
+	ID            int `json:"id" gorm:"primary_key"`
+	UserID        int `json:"user_id" gorm:"type:int;index"`
+	PostalAddress `gorm:"embedded"`
+	IsDefault     bool      `json:"is_default"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// ShippingCountry describes how addresses in a country are checked.
+type ShippingCountry struct {
+	PostalCode     *regexp.Regexp
+	RegionRequired bool
+}
+
+// ShippingCountries lists the countries orders can ship to, keyed by ISO
+// 3166-1 alpha-2 code.
+var ShippingCountries = map[string]ShippingCountry{
+	"US": {PostalCode: regexp.MustCompile(`^\d{5}(-\d{4})?$`), RegionRequired: true},
+	"CA": {PostalCode: regexp.MustCompile(`^[A-Z]\d[A-Z] ?\d[A-Z]\d$`), RegionRequired: true},
+	"AU": {PostalCode: regexp.MustCompile(`^\d{4}$`), RegionRequired: true},
+	"IN": {PostalCode: regexp.MustCompile(`^\d{6}$`), RegionRequired: true},
+	"JP": {PostalCode: regexp.MustCompile(`^\d{3}-?\d{4}$`), RegionRequired: true},
+	"GB": {PostalCode: regexp.MustCompile(`^[A-Z]{1,2}\d[A-Z\d]? ?\d[A-Z]{2}$`)},
+	"DE": {PostalCode: regexp.MustCompile(`^\d{5}$`)},
+	"FR": {PostalCode: regexp.MustCompile(`^\d{5}$`)},
+	"NL": {PostalCode: regexp.MustCompile(`^\d{4} ?[A-Z]{2}$`)},
+}
@@ -1,15 +1,33 @@
 package models
 
+import "time"
+
+// Cart statuses. A user has at most one active cart, which items are added
+// to and which is checked out, and any number of open carts to switch to.
+const (
+	CartStatusActive  = "active"
+	CartStatusOpen    = "open"
+	CartStatusSaved   = "saved"   // The user's save for later list
+	CartStatusOrdered = "ordered" // Checked out
+)
+
+// Cart holds what a shopper means to buy. A guest's cart has no user and is
+// found by the hash of its cart token instead, until it expires.
 type Cart struct {
-	ID        int    `json:"id" gorm:"primary_key"`
-	UserID    int    `json:"user_id" gorm:"type:int"`
-	Name      string `json:"name" gorm:"type:varchar"`
-	Status    string `json:"status" gorm:"type:varchar"`
-	CreatedAt string `json:"created_at" gorm:"type:timestamp"`
+	ID        int        `json:"id" gorm:"primary_key"`
+	UserID    int        `json:"user_id" gorm:"type:int"`
+	Name      string     `json:"name" gorm:"type:varchar"`
+	Status    string     `json:"status" gorm:"type:varchar"`
+	CouponID  int        `json:"coupon_id" gorm:"type:int"` // Coupon applied to the cart, 0 for none
+	TokenHash string     `json:"-" gorm:"type:varchar;index"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"` // Set for guest carts only
+	CreatedAt string     `json:"created_at" gorm:"type:timestamp"`
 }
 
+// CartItem is one line of a cart. A cart holds at most one line per item,
+// enforced by the composite key on (cart_id, item_id).
 type CartItem struct {
-	CartID   int `json:"cart_id" gorm:"type:int"`
-	ItemID   int `json:"item_id" gorm:"type:int"`
+	CartID   int `json:"cart_id" gorm:"type:int;primary_key;auto_increment:false"`
+	ItemID   int `json:"item_id" gorm:"type:int;primary_key;auto_increment:false"`
 	Quantity int `json:"quantity" gorm:"type:int;default:1"`
 }
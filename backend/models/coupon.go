@@ -0,0 +1,77 @@
+package models
+
+import (
+	"shopping-cart/money"
+	"strings"
+	"time"
+)
+
+// Coupon types.
+const (
+	CouponPercentOff   = "percent_off"   // PercentOff percent off each eligible line
+	CouponAmountOff    = "amount_off"    // AmountOff spread across the eligible lines
+	CouponBuyXGetY     = "buy_x_get_y"   // GetQuantity free for every BuyQuantity bought of an item
+	CouponFreeShipping = "free_shipping" // No charge for shipping
+)
+
+var CouponTypes = []string{CouponPercentOff, CouponAmountOff, CouponBuyXGetY, CouponFreeShipping}
+
+// Coupon is a promotion shoppers apply to their cart by code. Category and
+// Brand, when set, limit the discount to matching items. Zero usage limits
+// mean unlimited.
+type Coupon struct {
+	ID            int         `json:"id" gorm:"primary_key"`
+	Code          string      `json:"code" gorm:"type:varchar;unique_index"`
+	Type          string      `json:"type" gorm:"type:varchar"`
+	PercentOff    int         `json:"percent_off" gorm:"type:int"`
+	AmountOff     money.Money `json:"amount_off" gorm:"embedded;embedded_prefix:amount_off_"`
+	BuyQuantity   int         `json:"buy_quantity" gorm:"type:int"`
+	GetQuantity   int         `json:"get_quantity" gorm:"type:int"`
+	Category      string      `json:"category" gorm:"type:varchar"`
+	Brand         string      `json:"brand" gorm:"type:varchar"`
+	MinSpend      money.Money `json:"min_spend" gorm:"embedded;embedded_prefix:min_spend_"`
+	StartsAt      *time.Time  `json:"starts_at"`
+	EndsAt        *time.Time  `json:"ends_at"`
+	UsageLimit    int         `json:"usage_limit" gorm:"type:int"`
+	PerUserLimit  int         `json:"per_user_limit" gorm:"type:int"`
+	TimesRedeemed int         `json:"times_redeemed" gorm:"type:int"`
+	Active        bool        `json:"active"`
+	CreatedAt     time.Time   `json:"created_at"`
+}
+
+// Applies reports whether the coupon's category and brand scope covers line.
+func (c Coupon) Applies(line OrderItem) bool {
+	if c.Category != "" && c.Category != line.Category {
+		return false
+	}
+	if c.Brand != "" && c.Brand != line.Brand {
+		return false
+	}
+	return true
+}
+
+// CouponRedemption records a coupon used by an order.
+type CouponRedemption struct {
+	ID        int         `json:"id" gorm:"primary_key"`
+	CouponID  int         `json:"coupon_id" gorm:"type:int;index"`
+	UserID    int         `json:"user_id" gorm:"type:int;index"`
+	OrderID   int         `json:"order_id" gorm:"type:int;index"`
+	Discount  money.Money `json:"discount" gorm:"embedded;embedded_prefix:discount_"`
+	CreatedAt time.Time   `json:"created_at"`
+}
+
+// NormalizeCouponCode returns code in the form coupons are stored and looked
+// up by, so codes are case insensitive.
+func NormalizeCouponCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// ValidCouponType reports whether t is one of CouponTypes.
+func ValidCouponType(t string) bool {
+	for _, known := range CouponTypes {
+		if t == known {
+			return true
+		}
+	}
+	return false
+}
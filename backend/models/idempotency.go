@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// IdempotencyKey stores the first response to a request made with an
+// Idempotency-Key header, so retries of the same request can be replayed.
+// Keys belong to a user, or for guests to the cart token they sent, or to
+// their client if they sent none.
+type IdempotencyKey struct {
+	ID            int    `json:"id" gorm:"primary_key"`
+	UserID        int    `json:"user_id" gorm:"type:int;unique_index:idx_idempotency_owner_key"`
+	CartTokenHash string `json:"-" gorm:"type:varchar;unique_index:idx_idempotency_owner_key"`
+	Key           string `json:"key" gorm:"type:varchar;unique_index:idx_idempotency_owner_key"`
+	RequestHash   string `json:"request_hash" gorm:"type:varchar"`
+	Completed     bool   `json:"completed"`
+	StatusCode    int    `json:"status_code" gorm:"type:int"`
+	ContentType   string `json:"content_type" gorm:"type:varchar"`
+	ResponseBody  string `json:"response_body" gorm:"type:text"`
+	// Headers replayed with the response, such as a new guest cart token,
+	// as JSON
+	ResponseHeaders string    `json:"-" gorm:"type:text"`
+	CreatedAt       time.Time `json:"created_at" gorm:"index"`
+}
@@ -1,13 +1,68 @@
 package models
 
+import (
+	"shopping-cart/money"
+	"time"
+)
+
+const (
+	ItemStatusActive   = "active"
+	ItemStatusInactive = "inactive"
+)
+
+// ItemCategories lists the categories an item may be filed under.
+var ItemCategories = []string{
+	"Earbuds",
+	"Headphones",
+	"Professional",
+	"Gaming",
+	"Sports",
+	"Kids",
+	"Travel",
+}
+
 type Item struct {
-	ID          int     `json:"id" gorm:"primary_key"`
-	Name        string  `json:"name" gorm:"type:varchar"`
-	Status      string  `json:"status" gorm:"type:varchar"`
-	CreatedAt   string  `json:"created_at" gorm:"type:timestamp"`
-	Description string  `json:"description" gorm:"type:varchar"`
-	Price       float64 `json:"price" gorm:"type:decimal(10,2)"`
-	Category    string  `json:"category" gorm:"type:varchar"`
-	Brand       string  `json:"brand" gorm:"type:varchar"`
-	ImageURLs   string  `json:"image_urls" gorm:"type:varchar"` // Comma-separated URLs
+	ID          int         `json:"id" gorm:"primary_key"`
+	Name        string      `json:"name" gorm:"type:varchar"`
+	Status      string      `json:"status" gorm:"type:varchar"`
+	CreatedAt   time.Time   `json:"created_at"`
+	Description string      `json:"description" gorm:"type:varchar"`
+	Price       money.Money `json:"price" gorm:"embedded;embedded_prefix:price_"`
+	Stock       int         `json:"stock" gorm:"type:int;default:0"`
+	WeightGrams int         `json:"weight_grams" gorm:"type:int;default:0"`
+	LengthMM    int         `json:"length_mm" gorm:"type:int;default:0"` // Packed dimensions
+	WidthMM     int         `json:"width_mm" gorm:"type:int;default:0"`
+	HeightMM    int         `json:"height_mm" gorm:"type:int;default:0"`
+	Category    string      `json:"category" gorm:"type:varchar"`
+	Brand       string      `json:"brand" gorm:"type:varchar"`
+	ImageURLs   string      `json:"image_urls" gorm:"type:varchar"` // Comma-separated URLs
+}
+
+// ValidCategory reports whether category is one of ItemCategories.
+func ValidCategory(category string) bool {
+	for _, known := range ItemCategories {
+		if known == category {
+			return true
+		}
+	}
+	return false
+}
+
+// volumetricDivisor converts packed volume in cubic millimetres to the grams
+// carriers charge for it, the usual 5000 cm³ per kg.
+const volumetricDivisor = 5000
+
+// ShippingWeightGrams is the weight one unit is charged at for shipping: its
+// actual weight or its volumetric weight, whichever is greater.
+func (i Item) ShippingWeightGrams() int {
+	volumetric := i.LengthMM * i.WidthMM * i.HeightMM / volumetricDivisor
+	if volumetric > i.WeightGrams {
+		return volumetric
+	}
+	return i.WeightGrams
+}
+
+// ValidItemStatus reports whether status is a known item status.
+func ValidItemStatus(status string) bool {
+	return status == ItemStatusActive || status == ItemStatusInactive
 }
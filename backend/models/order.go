@@ -1,8 +1,76 @@
 package models
 
+import "shopping-cart/money"
+
 type Order struct {
-	ID        int    `json:"id" gorm:"primary_key"`
-	CartID    int    `json:"cart_id" gorm:"type:int"`
-	UserID    int    `json:"user_id" gorm:"type:int"`
-	CreatedAt string `json:"created_at" gorm:"type:timestamp"`
+	ID         int         `json:"id" gorm:"primary_key"`
+	CartID     int         `json:"cart_id" gorm:"type:int"`
+	UserID     int         `json:"user_id" gorm:"type:int"`
+	Status     string      `json:"status" gorm:"type:varchar;default:'pending'"`
+	Subtotal   money.Money `json:"subtotal" gorm:"embedded;embedded_prefix:subtotal_"`
+	Tax        money.Money `json:"tax" gorm:"embedded;embedded_prefix:tax_"`
+	Discount   money.Money `json:"discount" gorm:"embedded;embedded_prefix:discount_"`
+	Total      money.Money `json:"total" gorm:"embedded;embedded_prefix:total_"`
+	CouponCode string      `json:"coupon_code" gorm:"type:varchar"`
+	TaxRegion  string      `json:"tax_region" gorm:"type:varchar"`
+	// Whether the subtotal already includes Tax, rather than Tax being added
+	// on top of it
+	TaxInclusive bool `json:"tax_inclusive"`
+	// Empty until some of the payment is refunded, then partially_refunded
+	// or refunded. Kept apart from Status, which tracks fulfilment
+	RefundStatus string `json:"refund_status" gorm:"type:varchar"`
+	// The address book entry the order shipped to, and a copy of it as it
+	// was at checkout
+	ShippingAddressID int           `json:"shipping_address_id" gorm:"type:int"`
+	ShippingAddress   PostalAddress `json:"shipping_address" gorm:"embedded;embedded_prefix:shipping_"`
+	ShippingMethod    string        `json:"shipping_method" gorm:"type:varchar"`
+	Shipping          money.Money   `json:"shipping" gorm:"embedded;embedded_prefix:shipping_charge_"`
+	CreatedAt         string        `json:"created_at" gorm:"type:timestamp"`
+}
+
+// OrderItem is a line of an order as it was at checkout. The item details
+// and price are copied so later catalogue changes don't rewrite past orders.
+type OrderItem struct {
+	ID          int         `json:"id" gorm:"primary_key"`
+	OrderID     int         `json:"order_id" gorm:"type:int;index"`
+	ItemID      int         `json:"item_id" gorm:"type:int"`
+	Name        string      `json:"name" gorm:"type:varchar"`
+	Description string      `json:"description" gorm:"type:varchar"`
+	Category    string      `json:"category" gorm:"type:varchar"`
+	Brand       string      `json:"brand" gorm:"type:varchar"`
+	ImageURLs   string      `json:"image_urls" gorm:"type:varchar"`
+	UnitPrice   money.Money `json:"unit_price" gorm:"embedded;embedded_prefix:unit_price_"`
+	Quantity    int         `json:"quantity" gorm:"type:int"`
+	LineTotal   money.Money `json:"line_total" gorm:"embedded;embedded_prefix:line_total_"`
+	Discount    money.Money `json:"discount" gorm:"embedded;embedded_prefix:discount_"` // Share of the order's coupon discount
+	TaxRate     int64       `json:"tax_rate_bps" gorm:"type:int"`                       // Rate charged on the line, in basis points
+	Tax         money.Money `json:"tax" gorm:"embedded;embedded_prefix:tax_"`           // Tax on the line after its discount
+}
+
+// NewOrderItem snapshots item at its current price for the given quantity.
+func NewOrderItem(item Item, quantity int) OrderItem {
+	return OrderItem{
+		ItemID:      item.ID,
+		Name:        item.Name,
+		Description: item.Description,
+		Category:    item.Category,
+		Brand:       item.Brand,
+		ImageURLs:   item.ImageURLs,
+		UnitPrice:   item.Price,
+		Quantity:    quantity,
+		LineTotal:   item.Price.Mul(quantity),
+		Discount:    money.Zero(item.Price.Currency),
+		Tax:         money.Zero(item.Price.Currency),
+	}
+}
+
+// SetTotals fills in the order's subtotal and total from its lines, keeping
+// any tax and discount already set.
+func (o *Order) SetTotals(lines []OrderItem) {
+	subtotal := money.Zero(money.DefaultCurrency)
+	for _, line := range lines {
+		subtotal = subtotal.Add(line.LineTotal)
+	}
+	o.Subtotal = subtotal
+	o.Total = subtotal.Add(o.Tax).Sub(o.Discount)
 }
@@ -0,0 +1,60 @@
+package models
+
+import "time"
+
+const (
+	OrderStatusPending   = "pending"
+	OrderStatusPaid      = "paid"
+	OrderStatusFulfilled = "fulfilled"
+	OrderStatusShipped   = "shipped"
+	OrderStatusDelivered = "delivered"
+	OrderStatusCancelled = "cancelled"
+	OrderStatusRefunded  = "refunded"
+)
+
+// An order's refund status is kept apart from its status, so a partial refund
+// doesn't lose track of where the order is in fulfilment.
+const (
+	OrderRefundPartial = "partially_refunded"
+	OrderRefundFull    = "refunded"
+)
+
+// orderTransitions lists the statuses each status may move to. Cancelled and
+// refunded orders are final.
+var orderTransitions = map[string][]string{
+	OrderStatusPending:   {OrderStatusPaid, OrderStatusCancelled},
+	OrderStatusPaid:      {OrderStatusFulfilled, OrderStatusCancelled, OrderStatusRefunded},
+	OrderStatusFulfilled: {OrderStatusShipped, OrderStatusCancelled, OrderStatusRefunded},
+	OrderStatusShipped:   {OrderStatusDelivered, OrderStatusRefunded},
+	OrderStatusDelivered: {OrderStatusRefunded},
+	OrderStatusCancelled: {},
+	OrderStatusRefunded:  {},
+}
+
+// ValidOrderStatus reports whether status is a known order status.
+func ValidOrderStatus(status string) bool {
+	_, ok := orderTransitions[status]
+	return ok
+}
+
+// CanTransitionOrder reports whether an order may move from one status to
+// another.
+func CanTransitionOrder(from, to string) bool {
+	for _, allowed := range orderTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// OrderStatusChange records one move of an order between statuses.
+type OrderStatusChange struct {
+	ID         int       `json:"id" gorm:"primary_key"`
+	OrderID    int       `json:"order_id" gorm:"type:int;index"`
+	FromStatus string    `json:"from_status" gorm:"type:varchar"`
+	ToStatus   string    `json:"to_status" gorm:"type:varchar"`
+	ChangedBy  int       `json:"changed_by" gorm:"type:int"` // User who made the change
+	Note       string    `json:"note" gorm:"type:varchar"`
+	CreatedAt  time.Time `json:"created_at"`
+}
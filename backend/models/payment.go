@@ -0,0 +1,39 @@
+package models
+
+import (
+	"shopping-cart/money"
+	"time"
+)
+
+// Payment operations, one per call made to the payment provider.
+const (
+	PaymentAuthorize = "authorize"
+	PaymentCapture   = "capture"
+	PaymentVoid      = "void"
+	PaymentRefund    = "refund"
+)
+
+// Payment outcomes.
+const (
+	PaymentSucceeded = "succeeded"
+	PaymentDeclined  = "declined" // The provider turned the payment down
+	PaymentFailed    = "failed"   // The provider couldn't be reached or errored
+)
+
+// Payment records one attempt to move money for an order through the payment
+// provider, whatever its outcome.
+type Payment struct {
+	ID        int         `json:"id" gorm:"primary_key"`
+	OrderID   int         `json:"order_id" gorm:"type:int;index"`
+	Provider  string      `json:"provider" gorm:"type:varchar"`
+	Operation string      `json:"operation" gorm:"type:varchar"`
+	Status    string      `json:"status" gorm:"type:varchar"`
+	Amount    money.Money `json:"amount" gorm:"embedded;embedded_prefix:amount_"`
+	// The provider's reference for the transaction, set when it succeeded
+	Reference string `json:"reference" gorm:"type:varchar"`
+	// The authorization captured or voided, or the capture refunded
+	ParentReference string    `json:"parent_reference" gorm:"type:varchar"`
+	ErrorCode       string    `json:"error_code" gorm:"type:varchar"`
+	ErrorMessage    string    `json:"error_message" gorm:"type:varchar"`
+	CreatedAt       time.Time `json:"created_at"`
+}
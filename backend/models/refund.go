@@ -0,0 +1,41 @@
+package models
+
+import (
+	"shopping-cart/money"
+	"time"
+)
+
+// Refund statuses. A refund is pending while the payment provider is asked
+// for it, and counts against what is left to refund until it fails.
+const (
+	RefundPending   = "pending"
+	RefundSucceeded = "succeeded"
+	RefundFailed    = "failed"
+)
+
+// Refund gives back some or all of what was captured for an order.
+type Refund struct {
+	ID      int         `json:"id" gorm:"primary_key"`
+	OrderID int         `json:"order_id" gorm:"type:int;index"`
+	Status  string      `json:"status" gorm:"type:varchar"`
+	Amount  money.Money `json:"amount" gorm:"embedded;embedded_prefix:amount_"`
+	Reason  string      `json:"reason" gorm:"type:varchar"`
+	// Whether the refunded units were put back in stock
+	Restocked bool `json:"restocked"`
+	// The payment recording the provider's refund, and its reference
+	PaymentID int          `json:"payment_id" gorm:"type:int"`
+	Reference string       `json:"reference" gorm:"type:varchar"`
+	CreatedBy int          `json:"created_by" gorm:"type:int"`
+	CreatedAt time.Time    `json:"created_at"`
+	Lines     []RefundLine `json:"lines" gorm:"-"`
+}
+
+// RefundLine is the part of a refund given back for units of one order line.
+type RefundLine struct {
+	ID          int         `json:"-" gorm:"primary_key"`
+	RefundID    int         `json:"-" gorm:"type:int;index"`
+	OrderItemID int         `json:"order_item_id" gorm:"type:int"`
+	ItemID      int         `json:"item_id" gorm:"type:int"`
+	Quantity    int         `json:"quantity" gorm:"type:int"`
+	Amount      money.Money `json:"amount" gorm:"embedded;embedded_prefix:amount_"`
+}
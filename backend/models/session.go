@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// Session is a login on one device. All refresh tokens rotated from the same
+// login belong to one session, so revoking it ends the whole token family.
+type Session struct {
+	ID        int        `json:"id" gorm:"primary_key"`
+	UserID    int        `json:"user_id" gorm:"type:int;index"`
+	RevokedAt *time.Time `json:"revoked_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+type RefreshToken struct {
+	ID        int        `json:"id" gorm:"primary_key"`
+	SessionID int        `json:"session_id" gorm:"type:int;index"`
+	TokenHash string     `json:"-" gorm:"type:varchar;unique_index"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
@@ -0,0 +1,75 @@
+package models
+
+import (
+	"shopping-cart/money"
+	"strings"
+	"time"
+)
+
+// Codes of the shipping methods created with the store. Admins may add more.
+const (
+	ShippingStandard = "standard"
+	ShippingExpress  = "express"
+	ShippingPickup   = "pickup"
+)
+
+// ShippingMethod is a way an order can be delivered. It costs BaseRate plus
+// PerKgRate for every started kilogram of chargeable weight, unless a rate
+// for the destination region overrides those, and is free once the order's
+// merchandise reaches FreeOver (zero for never).
+type ShippingMethod struct {
+	ID             int                  `json:"id" gorm:"primary_key"`
+	Code           string               `json:"code" gorm:"type:varchar;unique_index"`
+	Name           string               `json:"name" gorm:"type:varchar"`
+	BaseRate       money.Money          `json:"base_rate" gorm:"embedded;embedded_prefix:base_rate_"`
+	PerKgRate      money.Money          `json:"per_kg_rate" gorm:"embedded;embedded_prefix:per_kg_rate_"`
+	FreeOver       money.Money          `json:"free_over" gorm:"embedded;embedded_prefix:free_over_"`
+	MaxWeightGrams int                  `json:"max_weight_grams" gorm:"type:int"` // 0 for no limit
+	Regions        string               `json:"regions" gorm:"type:varchar"`      // Comma-separated regions offered in, empty for everywhere
+	MinDays        int                  `json:"min_days" gorm:"type:int"`
+	MaxDays        int                  `json:"max_days" gorm:"type:int"`
+	Active         bool                 `json:"active"`
+	CreatedAt      time.Time            `json:"created_at"`
+	RegionRates    []ShippingRegionRate `json:"region_rates" gorm:"-"`
+}
+
+// ShippingRegionRate overrides a method's rates for deliveries to a region.
+type ShippingRegionRate struct {
+	ID        int         `json:"-" gorm:"primary_key"`
+	MethodID  int         `json:"-" gorm:"type:int;index"`
+	Region    string      `json:"region" gorm:"type:varchar"`
+	BaseRate  money.Money `json:"base_rate" gorm:"embedded;embedded_prefix:base_rate_"`
+	PerKgRate money.Money `json:"per_kg_rate" gorm:"embedded;embedded_prefix:per_kg_rate_"`
+}
+
+// RegionCovers reports whether region falls within area, which is either the
+// same region or the country it is part of, so "US" covers "US-CA".
+func RegionCovers(area, region string) bool {
+	return area == region || strings.HasPrefix(region, area+"-")
+}
+
+// AvailableIn reports whether the method delivers to region.
+func (m ShippingMethod) AvailableIn(region string) bool {
+	if strings.TrimSpace(m.Regions) == "" {
+		return true
+	}
+	for _, area := range strings.Split(m.Regions, ",") {
+		if RegionCovers(strings.TrimSpace(area), region) {
+			return true
+		}
+	}
+	return false
+}
+
+// RatesFor returns the base and per kilogram rates for deliveries to region:
+// those of the most specific region rate covering it, or the method's own.
+func (m ShippingMethod) RatesFor(region string) (money.Money, money.Money) {
+	base, perKg := m.BaseRate, m.PerKgRate
+	matched := ""
+	for _, rate := range m.RegionRates {
+		if RegionCovers(rate.Region, region) && len(rate.Region) > len(matched) {
+			base, perKg, matched = rate.BaseRate, rate.PerKgRate, rate.Region
+		}
+	}
+	return base, perKg
+}
@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+const (
+	StockReasonInitial    = "initial"
+	StockReasonAdjustment = "adjustment"
+	StockReasonOrder      = "order"
+	StockReasonCancel     = "cancellation"
+	StockReasonRefund     = "refund"
+)
+
+// StockAdjustment records one change to an item's stock level.
+type StockAdjustment struct {
+	ID         int       `json:"id" gorm:"primary_key"`
+	ItemID     int       `json:"item_id" gorm:"type:int;index"`
+	Delta      int       `json:"delta" gorm:"type:int"`
+	StockAfter int       `json:"stock_after" gorm:"type:int"`
+	Reason     string    `json:"reason" gorm:"type:varchar"`
+	Note       string    `json:"note" gorm:"type:varchar"`
+	UserID     int       `json:"user_id" gorm:"type:int"`  // Who made the change, 0 for the system
+	OrderID    int       `json:"order_id" gorm:"type:int"` // Set for changes caused by an order
+	CreatedAt  time.Time `json:"created_at"`
+}
@@ -1,10 +1,26 @@
 package models
 
+const (
+	RoleCustomer = "customer"
+	RoleStaff    = "staff"
+	RoleAdmin    = "admin"
+)
+
 type User struct {
 	ID        int    `json:"id" gorm:"primary_key"`
-	Username  string `json:"username" gorm:"type:varchar"`
+	Username  string `json:"username" gorm:"type:varchar;unique_index:idx_users_username"`
 	Password  string `json:"password" gorm:"type:varchar"`
 	Token     string `json:"token" gorm:"type:varchar"`
+	Role      string `json:"role" gorm:"type:varchar;default:'customer'"`
 	CartID    int    `json:"cart_id" gorm:"type:int"`
 	CreatedAt string `json:"created_at" gorm:"type:timestamp"`
 }
+
+// ValidRole reports whether role is one of the known user roles.
+func ValidRole(role string) bool {
+	switch role {
+	case RoleCustomer, RoleStaff, RoleAdmin:
+		return true
+	}
+	return false
+}
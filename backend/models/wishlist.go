@@ -0,0 +1,33 @@
+package models
+
+import (
+	"shopping-cart/money"
+	"time"
+)
+
+// Wishlist is a named list of items a user wants. A shared wishlist can be
+// viewed by anyone with its share link; only a hash of the link's token is
+// kept.
+type Wishlist struct {
+	ID             int       `json:"id" gorm:"primary_key"`
+	UserID         int       `json:"user_id" gorm:"type:int;index"`
+	Name           string    `json:"name" gorm:"type:varchar"`
+	ShareTokenHash string    `json:"-" gorm:"type:varchar;index"` // Empty unless shared
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// Shared reports whether the wishlist has a share link.
+func (w Wishlist) Shared() bool {
+	return w.ShareTokenHash != ""
+}
+
+// WishlistItem is an item on a wishlist, with its price and whether it was
+// in stock when added, so changes since can be pointed out. A wishlist holds
+// an item at most once.
+type WishlistItem struct {
+	WishlistID   int         `json:"wishlist_id" gorm:"type:int;primary_key;auto_increment:false"`
+	ItemID       int         `json:"item_id" gorm:"type:int;primary_key;auto_increment:false"`
+	AddedPrice   money.Money `json:"added_price" gorm:"embedded;embedded_prefix:added_price_"`
+	AddedInStock bool        `json:"added_in_stock"`
+	CreatedAt    time.Time   `json:"created_at"`
+}
@@ -0,0 +1,245 @@
+// Package money represents amounts as integer minor units (cents) with an
+// ISO 4217 currency code, so prices and totals are never rounded by floating
+// point arithmetic.
+//
+// Rounding rule: whenever an amount has to be scaled (rates, percentages),
+// the exact result is rounded to the nearest minor unit with halves rounded
+// away from zero.
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency is the currency the store prices in.
+const DefaultCurrency = "USD"
+
+// minorDigits is the number of minor unit digits for every supported
+// currency.
+const minorDigits = 2
+
+var ErrInvalidAmount = errors.New("invalid money amount")
+
+type Money struct {
+	Amount   int64  `json:"amount" gorm:"type:bigint"`
+	Currency string `json:"currency" gorm:"type:varchar(3)"`
+}
+
+// New returns amount minor units of currency.
+func New(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+// Zero returns a zero amount in currency.
+func Zero(currency string) Money {
+	return Money{Currency: currency}
+}
+
+// Parse reads a decimal amount in major units such as "199.99" or "-5". At
+// most two decimal places and a single leading minus sign are accepted, and
+// amounts too large to hold in minor units are rejected.
+func Parse(value, currency string) (Money, error) {
+	value = strings.TrimSpace(value)
+	negative := strings.HasPrefix(value, "-")
+	value = strings.TrimPrefix(value, "-")
+
+	whole, frac, hasFrac := strings.Cut(value, ".")
+	if !isDigits(whole) || (hasFrac && (!isDigits(frac) || len(frac) > minorDigits)) {
+		return Money{}, ErrInvalidAmount
+	}
+	frac += strings.Repeat("0", minorDigits-len(frac))
+
+	major, err := strconv.ParseInt(whole, 10, 64)
+	if err != nil {
+		return Money{}, ErrInvalidAmount
+	}
+	minor, err := strconv.ParseInt(frac, 10, 64)
+	if err != nil {
+		return Money{}, ErrInvalidAmount
+	}
+	if major > (math.MaxInt64-minor)/100 {
+		return Money{}, ErrInvalidAmount
+	}
+
+	amount := major*100 + minor
+	if negative {
+		amount = -amount
+	}
+	return New(amount, currency), nil
+}
+
+func (m Money) IsZero() bool {
+	return m.Amount == 0
+}
+
+func (m Money) IsPositive() bool {
+	return m.Amount > 0
+}
+
+// sameCurrency returns the currency shared by m and o. A zero value with no
+// currency adopts the other's. Mixing currencies is a programming error.
+func (m Money) sameCurrency(o Money) string {
+	switch {
+	case m.Currency == "":
+		return o.Currency
+	case o.Currency == "" || o.Currency == m.Currency:
+		return m.Currency
+	}
+	panic(fmt.Sprintf("money: currency mismatch %s and %s", m.Currency, o.Currency))
+}
+
+func (m Money) Add(o Money) Money {
+	return New(m.Amount+o.Amount, m.sameCurrency(o))
+}
+
+func (m Money) Sub(o Money) Money {
+	return New(m.Amount-o.Amount, m.sameCurrency(o))
+}
+
+// Mul multiplies by a whole quantity, which needs no rounding.
+func (m Money) Mul(quantity int) Money {
+	return New(m.Amount*int64(quantity), m.Currency)
+}
+
+// MulBasisPoints scales by rate/10000 (1 basis point = 0.01%), rounding half
+// away from zero.
+func (m Money) MulBasisPoints(rate int64) Money {
+	return m.MulDiv(rate, 10000)
+}
+
+// MulDiv scales by num/den, rounding half away from zero.
+func (m Money) MulDiv(num, den int64) Money {
+	return New(divRound(m.Amount*num, den), m.Currency)
+}
+
+// Min returns the smaller of m and o.
+func (m Money) Min(o Money) Money {
+	if o.Amount < m.Amount {
+		return New(o.Amount, m.sameCurrency(o))
+	}
+	return New(m.Amount, m.sameCurrency(o))
+}
+
+// Allocate splits m across the given weights in proportion, rounding each
+// share and giving the leftover minor units to the earliest shares so the
+// parts always sum to m.
+func (m Money) Allocate(weights []int64) []Money {
+	var total int64
+	for _, w := range weights {
+		total += w
+	}
+
+	parts := make([]Money, len(weights))
+	if total == 0 {
+		for i := range parts {
+			parts[i] = Zero(m.Currency)
+		}
+		return parts
+	}
+
+	var allocated int64
+	for i, w := range weights {
+		share := m.Amount * w / total
+		parts[i] = New(share, m.Currency)
+		allocated += share
+	}
+	step := int64(1)
+	if m.Amount < 0 {
+		step = -1
+	}
+	for i := 0; allocated != m.Amount; i = (i + 1) % len(parts) {
+		if weights[i] == 0 {
+			continue
+		}
+		parts[i].Amount += step
+		allocated += step
+	}
+	return parts
+}
+
+// String formats the amount in major units, e.g. "199.99".
+func (m Money) String() string {
+	amount := m.Amount
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, amount/100, amount%100)
+}
+
+// MarshalJSON writes the minor unit amount and currency along with the
+// formatted major unit amount for display.
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Amount    int64  `json:"amount"`
+		Currency  string `json:"currency"`
+		Formatted string `json:"formatted"`
+	}{m.Amount, m.Currency, m.String()})
+}
+
+// UnmarshalJSON accepts either {"amount": 19999, "currency": "USD"} or a
+// decimal in major units such as 199.99 or "199.99", which is taken to be in
+// DefaultCurrency.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	trimmed := strings.TrimSpace(string(data))
+	if strings.HasPrefix(trimmed, "{") {
+		var raw struct {
+			Amount   *int64 `json:"amount"`
+			Currency string `json:"currency"`
+		}
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return err
+		}
+		if raw.Amount == nil {
+			return ErrInvalidAmount
+		}
+		currency := raw.Currency
+		if currency == "" {
+			currency = DefaultCurrency
+		}
+		*m = New(*raw.Amount, currency)
+		return nil
+	}
+
+	parsed, err := Parse(strings.Trim(trimmed, `"`), DefaultCurrency)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// isDigits reports whether s is one or more ASCII digits, with no sign.
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// divRound divides with halves rounded away from zero.
+func divRound(n, d int64) int64 {
+	q, r := n/d, n%d
+	if r < 0 {
+		r = -r
+	}
+	if 2*r >= d {
+		if n < 0 {
+			q--
+		} else {
+			q++
+		}
+	}
+	return q
+}
@@ -0,0 +1,137 @@
+package money
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		value string
+		want  int64
+		err   bool
+	}{
+		{value: "199.99", want: 19999},
+		{value: "5", want: 500},
+		{value: "5.5", want: 550},
+		{value: "0.05", want: 5},
+		{value: " 12.30 ", want: 1230},
+		{value: "-5", want: -500},
+		{value: "-0.01", want: -1},
+		{value: "92233720368547758.07", want: 9223372036854775807},
+		{value: "", err: true},
+		{value: "-", err: true},
+		{value: ".5", err: true},
+		{value: "5.", err: true},
+		{value: "5.123", err: true},
+		{value: "--5", err: true},
+		{value: "+5", err: true},
+		{value: "-+5", err: true},
+		{value: "5.-1", err: true},
+		{value: "5.+1", err: true},
+		{value: "1,000", err: true},
+		{value: "1e3", err: true},
+		{value: "92233720368547758.08", err: true},
+		{value: "99999999999999999", err: true},
+		{value: "9223372036854775808", err: true},
+	}
+
+	for _, tt := range tests {
+		got, err := Parse(tt.value, DefaultCurrency)
+		if tt.err {
+			if !errors.Is(err, ErrInvalidAmount) {
+				t.Errorf("Parse(%q) = %v, %v; want ErrInvalidAmount", tt.value, got, err)
+			}
+			continue
+		}
+		if err != nil || got != New(tt.want, DefaultCurrency) {
+			t.Errorf("Parse(%q) = %v, %v; want %d", tt.value, got, err, tt.want)
+		}
+	}
+}
+
+func TestDivRound(t *testing.T) {
+	tests := []struct {
+		n, d, want int64
+	}{
+		{n: 10, d: 5, want: 2},
+		{n: 14, d: 10, want: 1},
+		{n: 15, d: 10, want: 2},
+		{n: 16, d: 10, want: 2},
+		{n: 25, d: 10, want: 3},
+		{n: -14, d: 10, want: -1},
+		{n: -15, d: 10, want: -2},
+		{n: -25, d: 10, want: -3},
+		{n: 1, d: 3, want: 0},
+		{n: 2, d: 3, want: 1},
+		{n: 0, d: 7, want: 0},
+	}
+
+	for _, tt := range tests {
+		if got := divRound(tt.n, tt.d); got != tt.want {
+			t.Errorf("divRound(%d, %d) = %d; want %d", tt.n, tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestMulBasisPoints(t *testing.T) {
+	tests := []struct {
+		amount, rate, want int64
+	}{
+		{amount: 19999, rate: 825, want: 1650}, // 1649.9175
+		{amount: 1000, rate: 725, want: 73},    // 72.5, half rounds up
+		{amount: -1000, rate: 725, want: -73},  // -72.5, half rounds away from zero
+		{amount: 333, rate: 1000, want: 33},    // 33.3
+		{amount: 999, rate: 10000, want: 999},  // 100%
+		{amount: 12345, rate: 0, want: 0},
+	}
+
+	for _, tt := range tests {
+		got := New(tt.amount, DefaultCurrency).MulBasisPoints(tt.rate)
+		if got.Amount != tt.want {
+			t.Errorf("%d at %d bps = %d; want %d", tt.amount, tt.rate, got.Amount, tt.want)
+		}
+	}
+}
+
+func TestAllocate(t *testing.T) {
+	tests := []struct {
+		amount  int64
+		weights []int64
+		want    []int64
+	}{
+		{amount: 100, weights: []int64{1, 1, 1}, want: []int64{34, 33, 33}},
+		{amount: 5, weights: []int64{1, 1, 1, 1, 1, 1}, want: []int64{1, 1, 1, 1, 1, 0}},
+		{amount: 1000, weights: []int64{1999, 1}, want: []int64{1000, 0}},
+		{amount: 1001, weights: []int64{3, 7}, want: []int64{301, 700}},
+		{amount: 100, weights: []int64{0, 1, 1}, want: []int64{0, 50, 50}},
+		{amount: 101, weights: []int64{0, 1, 1}, want: []int64{0, 51, 50}},
+		{amount: -100, weights: []int64{1, 1, 1}, want: []int64{-34, -33, -33}},
+		{amount: 100, weights: []int64{0, 0}, want: []int64{0, 0}},
+		{amount: 0, weights: []int64{2, 3}, want: []int64{0, 0}},
+		{amount: 1667, weights: []int64{5999, 2999, 1999}, want: []int64{910, 454, 303}},
+	}
+
+	for _, tt := range tests {
+		parts := New(tt.amount, DefaultCurrency).Allocate(tt.weights)
+		got := make([]int64, len(parts))
+		for i, part := range parts {
+			got[i] = part.Amount
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Allocate(%d, %v) = %v; want %v", tt.amount, tt.weights, got, tt.want)
+		}
+
+		// Unless there is nothing to weigh by, the parts add back up to the
+		// whole, e.g. an order's tax split across its lines
+		var sum, totalWeight int64
+		for i, amount := range got {
+			sum += amount
+			totalWeight += tt.weights[i]
+		}
+		if totalWeight > 0 && sum != tt.amount {
+			t.Errorf("Allocate(%d, %v) parts sum to %d", tt.amount, tt.weights, sum)
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package payment
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"shopping-cart/money"
+	"sync"
+)
+
+// Payment sources the fake gateway treats specially. Any other source is
+// approved.
+const (
+	FakeSourceDeclined          = "tok_declined"           // Authorization is declined
+	FakeSourceInsufficientFunds = "tok_insufficient_funds" // Authorization is declined for lack of funds
+	FakeSourceCaptureDeclined   = "tok_capture_declined"   // Authorized, but capture is declined
+	FakeSourceGatewayError      = "tok_gateway_error"      // The gateway fails to respond
+)
+
+// ErrGatewayUnavailable is the error the fake gateway returns for
+// FakeSourceGatewayError, standing in for a network or server failure.
+var ErrGatewayUnavailable = errors.New("payment gateway unavailable")
+
+type fakeAuthorization struct {
+	source    string
+	amount    money.Money
+	captureID string
+	voided    bool
+	captured  money.Money
+	refunded  money.Money
+}
+
+// FakeGateway is a Provider that never leaves the process, for development
+// and tests. It checks amounts and states the way a real gateway would, but
+// keeps its records in memory, so they are lost on restart: refunding a
+// capture made before a restart is declined with "unknown_capture".
+type FakeGateway struct {
+	mu             sync.Mutex
+	authorizations map[string]*fakeAuthorization
+	captures       map[string]*fakeAuthorization
+}
+
+// NewFakeGateway returns a fake gateway with no payments.
+func NewFakeGateway() *FakeGateway {
+	return &FakeGateway{
+		authorizations: map[string]*fakeAuthorization{},
+		captures:       map[string]*fakeAuthorization{},
+	}
+}
+
+func (g *FakeGateway) Name() string {
+	return "fake"
+}
+
+func (g *FakeGateway) Authorize(source string, amount money.Money, reference string) (Transaction, error) {
+	switch source {
+	case FakeSourceDeclined:
+		return Transaction{}, &DeclinedError{Code: "card_declined", Message: "The card was declined"}
+	case FakeSourceInsufficientFunds:
+		return Transaction{}, &DeclinedError{Code: "insufficient_funds", Message: "The card has insufficient funds"}
+	case FakeSourceGatewayError:
+		return Transaction{}, ErrGatewayUnavailable
+	}
+	if source == "" {
+		return Transaction{}, &DeclinedError{Code: "invalid_source", Message: "No payment source given"}
+	}
+	if !amount.IsPositive() {
+		return Transaction{}, &DeclinedError{Code: "invalid_amount", Message: "Amount must be positive"}
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	id := fakeID("auth_")
+	g.authorizations[id] = &fakeAuthorization{
+		source:   source,
+		amount:   amount,
+		captured: money.Zero(amount.Currency),
+		refunded: money.Zero(amount.Currency),
+	}
+	return Transaction{ID: id, Amount: amount}, nil
+}
+
+func (g *FakeGateway) Capture(authorizationID string, amount money.Money) (Transaction, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	auth, ok := g.authorizations[authorizationID]
+	switch {
+	case !ok:
+		return Transaction{}, &DeclinedError{Code: "unknown_authorization", Message: "No such authorization"}
+	case auth.voided:
+		return Transaction{}, &DeclinedError{Code: "authorization_voided", Message: "The authorization was voided"}
+	case auth.captureID != "":
+		return Transaction{}, &DeclinedError{Code: "already_captured", Message: "The authorization was already captured"}
+	case auth.source == FakeSourceCaptureDeclined:
+		return Transaction{}, &DeclinedError{Code: "capture_declined", Message: "The capture was declined"}
+	case amount.Currency != auth.amount.Currency || !amount.IsPositive() || amount.Amount > auth.amount.Amount:
+		return Transaction{}, &DeclinedError{Code: "invalid_amount", Message: "Amount exceeds the authorization"}
+	}
+
+	auth.captureID = fakeID("cap_")
+	auth.captured = amount
+	g.captures[auth.captureID] = auth
+	return Transaction{ID: auth.captureID, Amount: amount}, nil
+}
+
+func (g *FakeGateway) Void(authorizationID string) (Transaction, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	auth, ok := g.authorizations[authorizationID]
+	switch {
+	case !ok:
+		return Transaction{}, &DeclinedError{Code: "unknown_authorization", Message: "No such authorization"}
+	case auth.captureID != "":
+		return Transaction{}, &DeclinedError{Code: "already_captured", Message: "A captured authorization can't be voided"}
+	}
+
+	auth.voided = true
+	return Transaction{ID: fakeID("void_"), Amount: auth.amount}, nil
+}
+
+func (g *FakeGateway) Refund(captureID string, amount money.Money) (Transaction, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	auth, ok := g.captures[captureID]
+	if !ok {
+		return Transaction{}, &DeclinedError{Code: "unknown_capture", Message: "No such capture"}
+	}
+	if amount.Currency != auth.captured.Currency || !amount.IsPositive() ||
+		auth.refunded.Amount+amount.Amount > auth.captured.Amount {
+		return Transaction{}, &DeclinedError{Code: "invalid_amount", Message: "Amount exceeds what is left to refund"}
+	}
+
+	auth.refunded = auth.refunded.Add(amount)
+	return Transaction{ID: fakeID("ref_"), Amount: amount}, nil
+}
+
+func fakeID(prefix string) string {
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		panic(err)
+	}
+	return prefix + hex.EncodeToString(buf)
+}
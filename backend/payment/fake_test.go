@@ -0,0 +1,136 @@
+package payment
+
+import (
+	"errors"
+	"shopping-cart/money"
+	"testing"
+)
+
+func usd(amount int64) money.Money {
+	return money.New(amount, money.DefaultCurrency)
+}
+
+// declineCode returns the code of a *DeclinedError, or "" for any other
+// error.
+func declineCode(err error) string {
+	var declined *DeclinedError
+	if errors.As(err, &declined) {
+		return declined.Code
+	}
+	return ""
+}
+
+func TestFakeAuthorize(t *testing.T) {
+	tests := []struct {
+		source string
+		amount int64
+		code   string
+	}{
+		{source: "tok_visa", amount: 1000},
+		{source: FakeSourceDeclined, amount: 1000, code: "card_declined"},
+		{source: FakeSourceInsufficientFunds, amount: 1000, code: "insufficient_funds"},
+		{source: "", amount: 1000, code: "invalid_source"},
+		{source: "tok_visa", amount: 0, code: "invalid_amount"},
+	}
+
+	gateway := NewFakeGateway()
+	for _, tt := range tests {
+		txn, err := gateway.Authorize(tt.source, usd(tt.amount), "order-1")
+		if code := declineCode(err); code != tt.code {
+			t.Errorf("Authorize(%q, %d) declined with %q (%v); want %q", tt.source, tt.amount, code, err, tt.code)
+		}
+		if tt.code == "" && (txn.ID == "" || txn.Amount != usd(tt.amount)) {
+			t.Errorf("Authorize(%q, %d) = %+v", tt.source, tt.amount, txn)
+		}
+	}
+
+	if _, err := gateway.Authorize(FakeSourceGatewayError, usd(1000), "order-1"); !errors.Is(err, ErrGatewayUnavailable) {
+		t.Errorf("Authorize(%q) = %v; want ErrGatewayUnavailable", FakeSourceGatewayError, err)
+	}
+}
+
+func TestFakeCapture(t *testing.T) {
+	gateway := NewFakeGateway()
+	auth, err := gateway.Authorize("tok_visa", usd(1000), "order-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := gateway.Capture(auth.ID, usd(1001)); declineCode(err) != "invalid_amount" {
+		t.Errorf("capturing more than authorized: %v; want invalid_amount", err)
+	}
+	capture, err := gateway.Capture(auth.ID, usd(1000))
+	if err != nil || capture.ID == "" || capture.Amount != usd(1000) {
+		t.Fatalf("Capture = %+v, %v", capture, err)
+	}
+	if _, err := gateway.Capture(auth.ID, usd(1000)); declineCode(err) != "already_captured" {
+		t.Errorf("capturing twice: %v; want already_captured", err)
+	}
+	if _, err := gateway.Capture("auth_missing", usd(1000)); declineCode(err) != "unknown_authorization" {
+		t.Errorf("capturing an unknown authorization: %v; want unknown_authorization", err)
+	}
+
+	declined, err := gateway.Authorize(FakeSourceCaptureDeclined, usd(1000), "order-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gateway.Capture(declined.ID, usd(1000)); declineCode(err) != "capture_declined" {
+		t.Errorf("capturing %q: %v; want capture_declined", FakeSourceCaptureDeclined, err)
+	}
+}
+
+func TestFakeVoid(t *testing.T) {
+	gateway := NewFakeGateway()
+	auth, err := gateway.Authorize("tok_visa", usd(1000), "order-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := gateway.Void(auth.ID); err != nil {
+		t.Fatalf("Void = %v", err)
+	}
+	if _, err := gateway.Capture(auth.ID, usd(1000)); declineCode(err) != "authorization_voided" {
+		t.Errorf("capturing a voided authorization: %v; want authorization_voided", err)
+	}
+	if _, err := gateway.Void("auth_missing"); declineCode(err) != "unknown_authorization" {
+		t.Errorf("voiding an unknown authorization: %v; want unknown_authorization", err)
+	}
+
+	captured, err := gateway.Authorize("tok_visa", usd(1000), "order-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gateway.Capture(captured.ID, usd(1000)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := gateway.Void(captured.ID); declineCode(err) != "already_captured" {
+		t.Errorf("voiding a captured authorization: %v; want already_captured", err)
+	}
+}
+
+func TestFakeRefund(t *testing.T) {
+	gateway := NewFakeGateway()
+	auth, err := gateway.Authorize("tok_visa", usd(1000), "order-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	capture, err := gateway.Capture(auth.ID, usd(1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := gateway.Refund(capture.ID, usd(600)); err != nil {
+		t.Fatalf("partial Refund = %v", err)
+	}
+	if _, err := gateway.Refund(capture.ID, usd(401)); declineCode(err) != "invalid_amount" {
+		t.Errorf("refunding more than is left: %v; want invalid_amount", err)
+	}
+	if _, err := gateway.Refund(capture.ID, usd(400)); err != nil {
+		t.Errorf("refunding the rest = %v", err)
+	}
+
+	// A new gateway, like the server after a restart, knows no captures
+	if _, err := NewFakeGateway().Refund(capture.ID, usd(100)); declineCode(err) != "unknown_capture" {
+		t.Errorf("refunding on a new gateway: %v; want unknown_capture", err)
+	}
+}
@@ -0,0 +1,51 @@
+package payment
+
+import (
+	"fmt"
+	"shopping-cart/money"
+)
+
+// Transaction is the provider's record of money authorized, captured or
+// refunded.
+type Transaction struct {
+	// ID is the provider's reference, used to capture, void or refund later
+	ID     string
+	Amount money.Money
+}
+
+// Refunder gives back money a payment gateway captured.
+type Refunder interface {
+	// Refund gives back amount, at most what is left of a capture.
+	Refund(captureID string, amount money.Money) (Transaction, error)
+}
+
+// Provider takes payments through a payment gateway. An order's payment is
+// authorized against the shopper's payment source, then captured; an
+// authorization that won't be captured is voided.
+type Provider interface {
+	Refunder
+
+	// Name identifies the provider in recorded payments.
+	Name() string
+	// Authorize reserves amount on the payment source, which is a token the
+	// client obtained from the provider. reference is the store's own
+	// reference for the payment.
+	Authorize(source string, amount money.Money, reference string) (Transaction, error)
+	// Capture collects amount, at most the authorized amount, from an
+	// authorization.
+	Capture(authorizationID string, amount money.Money) (Transaction, error)
+	// Void releases an authorization that hasn't been captured.
+	Void(authorizationID string) (Transaction, error)
+}
+
+// DeclinedError is returned when the provider turns a payment down, as
+// opposed to failing to process it.
+type DeclinedError struct {
+	// Code is a machine readable reason, e.g. "card_declined"
+	Code    string
+	Message string
+}
+
+func (e *DeclinedError) Error() string {
+	return fmt.Sprintf("payment declined: %s: %s", e.Code, e.Message)
+}
@@ -0,0 +1,82 @@
+package search
+
+import (
+	"strings"
+	"unicode"
+
+	"shopping-cart/models"
+)
+
+// Searcher is a full-text index over the catalogue. Only active items are
+// searchable; indexing an inactive item removes it.
+type Searcher interface {
+	// Rebuild replaces the index contents with the given items.
+	Rebuild(items []models.Item) error
+	// Index adds or refreshes one item.
+	Index(item models.Item) error
+	// Remove drops an item from the index.
+	Remove(itemID int) error
+	// Search returns the IDs of matching items ordered by relevance, limited
+	// to one page, along with the total number of matches.
+	Search(query string, offset, limit int) ([]int, int, error)
+}
+
+// tokenize lower-cases the query and splits it into letter and digit runs.
+func tokenize(query string) []string {
+	return strings.FieldsFunc(strings.ToLower(query), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// maxTypos is how many edits a query term may be away from an indexed term.
+// Short terms must match exactly, or they would match almost anything.
+func maxTypos(term string) int {
+	n := len([]rune(term))
+	switch {
+	case n >= 8:
+		return 2
+	case n >= 4:
+		return 1
+	}
+	return 0
+}
+
+// editDistance is the Levenshtein distance between a and b, giving up early
+// once it exceeds limit.
+func editDistance(a, b string, limit int) int {
+	ra, rb := []rune(a), []rune(b)
+	if abs(len(ra)-len(rb)) > limit {
+		return limit + 1
+	}
+
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		rowMin := curr[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+			rowMin = min(rowMin, curr[j])
+		}
+		if rowMin > limit {
+			return limit + 1
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,195 @@
+package search
+
+import (
+	"encoding/binary"
+	"math"
+	"sort"
+	"strings"
+
+	"shopping-cart/models"
+
+	"github.com/jinzhu/gorm"
+)
+
+// Column weights for relevance, in the order the FTS table declares them.
+var columnWeights = []float64{
+	4, // name
+	2, // brand
+	2, // category
+	1, // description
+}
+
+// SQLiteSearcher keeps an FTS4 table alongside the items table. FTS4 is used
+// rather than FTS5 because it is compiled into the default go-sqlite3 build.
+type SQLiteSearcher struct {
+	db *gorm.DB
+}
+
+func NewSQLiteSearcher(db *gorm.DB) (*SQLiteSearcher, error) {
+	statements := []string{
+		`CREATE VIRTUAL TABLE IF NOT EXISTS items_fts USING fts4(name, brand, category, description, tokenize=unicode61)`,
+		`CREATE VIRTUAL TABLE IF NOT EXISTS items_fts_terms USING fts4aux(items_fts)`,
+	}
+	for _, stmt := range statements {
+		if err := db.Exec(stmt).Error; err != nil {
+			return nil, err
+		}
+	}
+	return &SQLiteSearcher{db: db}, nil
+}
+
+func (s *SQLiteSearcher) Rebuild(items []models.Item) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`DELETE FROM items_fts`).Error; err != nil {
+			return err
+		}
+		for _, item := range items {
+			if err := indexItem(tx, item); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *SQLiteSearcher) Index(item models.Item) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		return indexItem(tx, item)
+	})
+}
+
+func (s *SQLiteSearcher) Remove(itemID int) error {
+	return s.db.Exec(`DELETE FROM items_fts WHERE docid = ?`, itemID).Error
+}
+
+func indexItem(tx *gorm.DB, item models.Item) error {
+	if err := tx.Exec(`DELETE FROM items_fts WHERE docid = ?`, item.ID).Error; err != nil {
+		return err
+	}
+	if item.Status != models.ItemStatusActive {
+		return nil
+	}
+	return tx.Exec(
+		`INSERT INTO items_fts (docid, name, brand, category, description) VALUES (?, ?, ?, ?, ?)`,
+		item.ID, item.Name, item.Brand, item.Category, item.Description,
+	).Error
+}
+
+func (s *SQLiteSearcher) Search(query string, offset, limit int) ([]int, int, error) {
+	terms := tokenize(query)
+	if len(terms) == 0 {
+		return []int{}, 0, nil
+	}
+
+	match, err := s.matchExpression(terms)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := s.db.Raw(
+		`SELECT docid, matchinfo(items_fts, 'pcnx') FROM items_fts WHERE items_fts MATCH ?`,
+		match,
+	).Rows()
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	type hit struct {
+		id    int
+		score float64
+	}
+	var hits []hit
+	for rows.Next() {
+		var id int
+		var info []byte
+		if err := rows.Scan(&id, &info); err != nil {
+			return nil, 0, err
+		}
+		hits = append(hits, hit{id: id, score: score(info)})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].score != hits[j].score {
+			return hits[i].score > hits[j].score
+		}
+		return hits[i].id < hits[j].id
+	})
+
+	ids := []int{}
+	for i := offset; i < len(hits) && i < offset+limit; i++ {
+		ids = append(ids, hits[i].id)
+	}
+	return ids, len(hits), nil
+}
+
+// matchExpression builds an FTS MATCH string requiring every query term,
+// where each term matches as a prefix or as any indexed word within its typo
+// allowance.
+func (s *SQLiteSearcher) matchExpression(terms []string) (string, error) {
+	var vocabulary []string
+	needsVocabulary := false
+	for _, term := range terms {
+		if maxTypos(term) > 0 {
+			needsVocabulary = true
+			break
+		}
+	}
+	if needsVocabulary {
+		if err := s.db.Raw(`SELECT DISTINCT term FROM items_fts_terms WHERE col = '*'`).Pluck("term", &vocabulary).Error; err != nil {
+			return "", err
+		}
+	}
+
+	groups := make([]string, 0, len(terms))
+	for _, term := range terms {
+		alternatives := []string{term + "*"}
+		if limit := maxTypos(term); limit > 0 {
+			for _, word := range vocabulary {
+				if word != term && editDistance(term, word, limit) <= limit {
+					alternatives = append(alternatives, word)
+				}
+			}
+		}
+		groups = append(groups, "("+strings.Join(alternatives, " OR ")+")")
+	}
+	return strings.Join(groups, " "), nil
+}
+
+// score ranks a row from its matchinfo 'pcnx' blob: for each phrase and
+// column, hits in this row weighted by column and by how rare the phrase is
+// across the index.
+func score(info []byte) float64 {
+	values := make([]uint32, len(info)/4)
+	for i := range values {
+		values[i] = binary.NativeEndian.Uint32(info[i*4:])
+	}
+	if len(values) < 3 {
+		return 0
+	}
+
+	phrases, columns, docs := int(values[0]), int(values[1]), float64(values[2])
+	total := 0.0
+	for p := 0; p < phrases; p++ {
+		for col := 0; col < columns; col++ {
+			base := 3 + 3*(p*columns+col)
+			if base+2 >= len(values) {
+				return total
+			}
+			hitsThisRow := float64(values[base])
+			docsWithHits := float64(values[base+2])
+			if hitsThisRow == 0 || docsWithHits == 0 {
+				continue
+			}
+			weight := 1.0
+			if col < len(columnWeights) {
+				weight = columnWeights[col]
+			}
+			total += weight * hitsThisRow * math.Log(1+docs/docsWithHits)
+		}
+	}
+	return total
+}
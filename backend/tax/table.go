@@ -0,0 +1,98 @@
+package tax
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Rule sets the rate for a region and item category. An empty Region or
+// Category matches any. A region also covers its subdivisions, so a rule for
+// "US" applies to "US-CA" unless a rule for "US-CA" is more specific.
+type Rule struct {
+	Region          string `json:"region"`
+	Category        string `json:"category"`
+	RateBasisPoints int64  `json:"rate_bps"`
+}
+
+// matches reports whether the rule covers region and category.
+func (r Rule) matches(region, category string) bool {
+	if r.Category != "" && r.Category != category {
+		return false
+	}
+	return r.Region == "" || r.Region == region || strings.HasPrefix(region, r.Region+"-")
+}
+
+// TableCalculator looks each line's rate up in a table of rules. The most
+// specific matching rule wins: the longest region first, then a rule for the
+// line's category over one for any category. Lines no rule covers are not
+// taxed.
+type TableCalculator struct {
+	Rules            []Rule `json:"rules"`
+	PricesIncludeTax bool   `json:"inclusive"`
+}
+
+// NewFlatRate returns a calculator charging one rate everywhere.
+func NewFlatRate(rateBasisPoints int64, inclusive bool) *TableCalculator {
+	return &TableCalculator{
+		Rules:            []Rule{{RateBasisPoints: rateBasisPoints}},
+		PricesIncludeTax: inclusive,
+	}
+}
+
+// LoadTable reads a calculator from a JSON file of the form
+// {"inclusive": false, "rules": [{"region": "US-CA", "category": "", "rate_bps": 725}]}.
+func LoadTable(path string) (*TableCalculator, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var table TableCalculator
+	if err := json.Unmarshal(data, &table); err != nil {
+		return nil, fmt.Errorf("parsing tax rules %s: %w", path, err)
+	}
+	for _, rule := range table.Rules {
+		if rule.RateBasisPoints < 0 {
+			return nil, fmt.Errorf("tax rule for region %q category %q has a negative rate", rule.Region, rule.Category)
+		}
+	}
+	return &table, nil
+}
+
+// Rate returns the rate for a line of category sold into region.
+func (t *TableCalculator) Rate(region, category string) int64 {
+	var best *Rule
+	for i, rule := range t.Rules {
+		if !rule.matches(region, category) {
+			continue
+		}
+		if best == nil || len(rule.Region) > len(best.Region) ||
+			(len(rule.Region) == len(best.Region) && rule.Category != "" && best.Category == "") {
+			best = &t.Rules[i]
+		}
+	}
+	if best == nil {
+		return 0
+	}
+	return best.RateBasisPoints
+}
+
+func (t *TableCalculator) Calculate(region string, lines []Line) ([]LineTax, error) {
+	taxes := make([]LineTax, len(lines))
+	for i, line := range lines {
+		rate := t.Rate(region, line.Category)
+		amount := line.Amount.MulDiv(rate, 10000)
+		if t.PricesIncludeTax {
+			// The amount is price plus tax, so the tax is rate/(1+rate) of it
+			amount = line.Amount.MulDiv(rate, 10000+rate)
+		}
+		taxes[i] = LineTax{RateBasisPoints: rate, Amount: amount}
+	}
+	return taxes, nil
+}
+
+func (t *TableCalculator) Inclusive() bool {
+	return t.PricesIncludeTax
+}
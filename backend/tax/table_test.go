@@ -0,0 +1,38 @@
+package tax
+
+import (
+	"shopping-cart/money"
+	"testing"
+)
+
+func TestCalculate(t *testing.T) {
+	tests := []struct {
+		name      string
+		inclusive bool
+		amount    int64
+		rate      int64
+		want      int64
+	}{
+		{name: "exclusive", amount: 19999, rate: 825, want: 1650},
+		{name: "exclusive half rounds up", amount: 1000, rate: 725, want: 73},
+		// Tax is rate/(1+rate) of a price that includes it
+		{name: "inclusive", inclusive: true, amount: 12000, rate: 2000, want: 2000},
+		{name: "inclusive rounds down", inclusive: true, amount: 1999, rate: 2000, want: 333}, // 333.17
+		{name: "inclusive rounds up", inclusive: true, amount: 1000, rate: 2000, want: 167},   // 166.67
+		{name: "inclusive half rounds up", inclusive: true, amount: 3, rate: 10000, want: 2},  // 1.5
+		{name: "inclusive negative", inclusive: true, amount: -1000, rate: 2000, want: -167},  // -166.67
+		{name: "zero rate", inclusive: true, amount: 1000, rate: 0, want: 0},
+	}
+
+	for _, tt := range tests {
+		calculator := NewFlatRate(tt.rate, tt.inclusive)
+		taxes, err := calculator.Calculate("US-CA", []Line{{Category: "Earbuds", Amount: money.New(tt.amount, money.DefaultCurrency)}})
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if taxes[0].Amount.Amount != tt.want || taxes[0].RateBasisPoints != tt.rate {
+			t.Errorf("%s: tax on %d at %d bps = %d at %d bps; want %d",
+				tt.name, tt.amount, tt.rate, taxes[0].Amount.Amount, taxes[0].RateBasisPoints, tt.want)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package tax
+
+import "shopping-cart/money"
+
+// Line is one taxable line: the amount charged for it after discounts, and
+// the item category its rate depends on.
+type Line struct {
+	Category string
+	Amount   money.Money
+}
+
+// LineTax is the tax on one line and the rate it was charged at.
+type LineTax struct {
+	RateBasisPoints int64
+	Amount          money.Money
+}
+
+// Calculator works out the tax on a set of lines for the region they are
+// sold into.
+type Calculator interface {
+	// Calculate returns the tax on each line, in the same order as lines.
+	Calculate(region string, lines []Line) ([]LineTax, error)
+	// Inclusive reports whether prices already include tax. If so the tax
+	// is the part of each amount that is tax; otherwise it is charged on top.
+	Inclusive() bool
+}
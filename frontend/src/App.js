@@ -9,6 +9,8 @@ import OrderConfirmation from './pages/OrderConfirmation';
 import Login from './pages/Login';
 import Signup from './pages/Signup';
 import OrderHistory from './pages/OrderHistory';
+import Addresses from './pages/Addresses';
+import Wishlists from './pages/Wishlists';
 import './App.css';
 
 // Protected Route component
@@ -35,16 +37,23 @@ function App() {
           <Route path="/product/:id" element={<ProductDetail />} />
           <Route path="/login" element={<Login />} />
           <Route path="/signup" element={<Signup />} />
+          <Route path="/cart" element={<Cart />} />
+          <Route path="/wishlists/shared/:token" element={<Wishlists />} />
 
           {/* Protected routes */}
-          <Route path="/cart" element={
+          <Route path="/orders" element={
             <ProtectedRoute>
-              <Cart />
+              <OrderHistory />
             </ProtectedRoute>
           } />
-          <Route path="/orders" element={
+          <Route path="/addresses" element={
             <ProtectedRoute>
-              <OrderHistory />
+              <Addresses />
+            </ProtectedRoute>
+          } />
+          <Route path="/wishlists" element={
+            <ProtectedRoute>
+              <Wishlists />
             </ProtectedRoute>
           } />
           <Route path="/order-confirmation" element={
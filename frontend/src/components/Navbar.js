@@ -1,5 +1,6 @@
 import React, { useState } from 'react';
 import { Link, useNavigate } from 'react-router-dom';
+import { logout } from '../services/api';
 import './Navbar.css';
 
 function Navbar() {
@@ -7,9 +8,12 @@ function Navbar() {
   const navigate = useNavigate();
   const username = localStorage.getItem('username');
 
-  const handleLogout = () => {
-    localStorage.removeItem('token');
-    localStorage.removeItem('username');
+  const handleLogout = async () => {
+    try {
+      await logout();
+    } catch (error) {
+      // Session is cleared locally even if the server call fails
+    }
     setIsDropdownOpen(false);
     navigate('/login');
   };
@@ -52,6 +56,22 @@ function Navbar() {
                   <i className="fas fa-box"></i>
                   Orders
                 </Link>
+                <Link 
+                  to="/addresses" 
+                  className="dropdown-item"
+                  onClick={() => setIsDropdownOpen(false)}
+                >
+                  <i className="fas fa-map-marker-alt"></i>
+                  Addresses
+                </Link>
+                <Link 
+                  to="/wishlists" 
+                  className="dropdown-item"
+                  onClick={() => setIsDropdownOpen(false)}
+                >
+                  <i className="fas fa-heart"></i>
+                  Wishlists
+                </Link>
                 <button 
                   className="dropdown-item"
                   onClick={handleLogout}
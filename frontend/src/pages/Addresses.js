@@ -0,0 +1,156 @@
+import React, { useState, useEffect } from 'react';
+import {
+  getAddresses,
+  createAddress,
+  updateAddress,
+  deleteAddress,
+  setDefaultAddress
+} from '../services/api';
+import './Addresses.css';
+
+const emptyAddress = {
+  name: '',
+  line1: '',
+  line2: '',
+  city: '',
+  region: '',
+  postal_code: '',
+  country: 'US',
+  phone: '',
+  is_default: false
+};
+
+function Addresses() {
+  const [addresses, setAddresses] = useState([]);
+  const [loading, setLoading] = useState(true);
+  const [error, setError] = useState(null);
+  const [form, setForm] = useState(emptyAddress);
+  const [editingId, setEditingId] = useState(null);
+
+  useEffect(() => {
+    loadAddresses();
+  }, []);
+
+  const loadAddresses = async () => {
+    try {
+      setLoading(true);
+      setAddresses(await getAddresses());
+    } catch (error) {
+      console.error('Error loading addresses:', error);
+      setError('Failed to load addresses. Please try again.');
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  const handleChange = (e) => {
+    const { name, value, type, checked } = e.target;
+    setForm({ ...form, [name]: type === 'checkbox' ? checked : value });
+  };
+
+  const handleSubmit = async (e) => {
+    e.preventDefault();
+    try {
+      setError(null);
+      if (editingId) {
+        await updateAddress(editingId, form);
+      } else {
+        await createAddress(form);
+      }
+      setForm(emptyAddress);
+      setEditingId(null);
+      loadAddresses();
+    } catch (error) {
+      setError(error.response?.data?.error || 'Failed to save address.');
+    }
+  };
+
+  const handleEdit = (address) => {
+    setEditingId(address.id);
+    setForm({ ...emptyAddress, ...address });
+  };
+
+  const handleDelete = async (id) => {
+    if (window.confirm('Delete this address?')) {
+      try {
+        await deleteAddress(id);
+        loadAddresses();
+      } catch (error) {
+        setError('Failed to delete address.');
+      }
+    }
+  };
+
+  const handleMakeDefault = async (id) => {
+    try {
+      await setDefaultAddress(id);
+      loadAddresses();
+    } catch (error) {
+      setError('Failed to update address.');
+    }
+  };
+
+  if (loading) {
+    return (
+      <div className="addresses-container loading-container">
+        <div className="spinner"></div>
+        <p>Loading your addresses...</p>
+      </div>
+    );
+  }
+
+  return (
+    <div className="addresses-container">
+      <h1>Your Addresses</h1>
+
+      {error && <div className="error-message">{error}</div>}
+
+      <div className="address-list">
+        {addresses.map((address) => (
+          <div key={address.id} className="address-card">
+            <p className="address-name">
+              {address.name} {address.is_default && <span className="default-badge">Default</span>}
+            </p>
+            <p>{address.line1}</p>
+            {address.line2 && <p>{address.line2}</p>}
+            <p>{address.city} {address.region} {address.postal_code}</p>
+            <p>{address.country}</p>
+            <div className="address-actions">
+              <button onClick={() => handleEdit(address)}>Edit</button>
+              {!address.is_default && (
+                <button onClick={() => handleMakeDefault(address.id)}>Make default</button>
+              )}
+              <button onClick={() => handleDelete(address.id)}>Delete</button>
+            </div>
+          </div>
+        ))}
+      </div>
+
+      <form className="address-form" onSubmit={handleSubmit}>
+        <h2>{editingId ? 'Edit address' : 'Add an address'}</h2>
+        <input name="name" placeholder="Full name" value={form.name} onChange={handleChange} required />
+        <input name="line1" placeholder="Address line 1" value={form.line1} onChange={handleChange} required />
+        <input name="line2" placeholder="Address line 2" value={form.line2} onChange={handleChange} />
+        <input name="city" placeholder="City" value={form.city} onChange={handleChange} required />
+        <input name="region" placeholder="State / province" value={form.region} onChange={handleChange} />
+        <input name="postal_code" placeholder="Postal code" value={form.postal_code} onChange={handleChange} required />
+        <input name="country" placeholder="Country code, e.g. US" value={form.country} onChange={handleChange} required />
+        <input name="phone" placeholder="Phone" value={form.phone} onChange={handleChange} />
+        <label>
+          <input type="checkbox" name="is_default" checked={form.is_default} onChange={handleChange} />
+          Use as my default address
+        </label>
+        <div className="address-actions">
+          <button type="submit">{editingId ? 'Save' : 'Add address'}</button>
+          {editingId && (
+            <button type="button" onClick={() => { setEditingId(null); setForm(emptyAddress); }}>
+              Cancel
+            </button>
+          )}
+        </div>
+      </form>
+    </div>
+  );
+}
+
+export default Addresses;
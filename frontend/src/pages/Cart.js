@@ -1,6 +1,9 @@
 import React, { useState, useEffect } from 'react';
 import { useNavigate } from 'react-router-dom';
-import { getCart, createOrder, deleteCartItem } from '../services/api';
+import {
+  getCart, createOrder, deleteCartItem, applyCoupon, removeCoupon, getAddresses, getShippingOptions,
+  getCarts, createCart, activateCart, getSavedForLater, saveForLater, moveToCart
+} from '../services/api';
 import './Cart.css';
 
 function Cart() {
@@ -8,18 +11,62 @@ function Cart() {
   const [loading, setLoading] = useState(true);
   const [checkingOut, setCheckingOut] = useState(false);
   const [error, setError] = useState(null);
+  const [couponCode, setCouponCode] = useState('');
+  const [couponError, setCouponError] = useState(null);
+  const [addresses, setAddresses] = useState([]);
+  const [addressId, setAddressId] = useState('');
+  const [shippingOptions, setShippingOptions] = useState([]);
+  const [shippingMethod, setShippingMethod] = useState('');
+  const [carts, setCarts] = useState([]);
+  const [saved, setSaved] = useState(null);
+  // The local fake gateway approves any token but its test ones, e.g.
+  // tok_declined
+  const [paymentToken, setPaymentToken] = useState('tok_visa');
   const navigate = useNavigate();
+  // Guests can fill a cart but must log in to check out
+  const isGuest = !localStorage.getItem('token');
 
   useEffect(() => {
     loadCart();
   }, []);
 
+  useEffect(() => {
+    if (!addressId || !cart || cart.items.length === 0) {
+      setShippingOptions([]);
+      setShippingMethod('');
+      return;
+    }
+    getShippingOptions(addressId)
+      .then((data) => {
+        setShippingOptions(data.options);
+        setShippingMethod((current) =>
+          data.options.some((option) => option.code === current)
+            ? current
+            : (data.options[0] ? data.options[0].code : ''));
+      })
+      .catch((error) => {
+        console.error('Error loading shipping options:', error);
+        setShippingOptions([]);
+        setShippingMethod('');
+      });
+  }, [addressId, cart]);
+
   const loadCart = async () => {
     try {
       setLoading(true);
       setError(null);
-      const data = await getCart();
+      const [data, addressBook, cartList, savedList] = await Promise.all([
+        getCart(),
+        isGuest ? Promise.resolve([]) : getAddresses(),
+        isGuest ? Promise.resolve([]) : getCarts(),
+        isGuest ? Promise.resolve(null) : getSavedForLater()
+      ]);
       setCart(data);
+      setCarts(cartList.filter((entry) => entry.status !== 'saved'));
+      setSaved(savedList);
+      setAddresses(addressBook);
+      const preferred = addressBook.find((address) => address.is_default) || addressBook[0];
+      setAddressId(preferred ? preferred.id : '');
     } catch (error) {
       console.error('Error loading cart:', error);
       setError('Error loading cart. Please try again.');
@@ -33,21 +80,36 @@ function Cart() {
       setCheckingOut(true);
       setError(null);
       
-      const response = await createOrder(cart.id);
+      const response = await createOrder(Number(addressId), shippingMethod, paymentToken);
       
       // Navigate to confirmation page with order details
       navigate('/order-confirmation', { 
         state: { 
           orderDetails: {
             order_id: response.order_id,
-            items: cart.items,
+            items: response.items,
+            subtotal: response.subtotal,
+            discount: response.discount,
+            tax: response.tax,
+            tax_inclusive: response.tax_inclusive,
+            shipping_address: response.shipping_address,
+            shipping_method: response.shipping_method,
+            shipping: response.shipping,
+            total: response.total,
             status: response.status
           }
         }
       });
     } catch (error) {
       console.error('Error creating order:', error);
-      setError(error.response?.data?.error || 'Failed to place order. Please try again.');
+      const data = error.response?.data;
+      if (data?.step === 'payment') {
+        // The order was placed but not paid for
+        setError(`${data.error}. Order #${data.order_id} is saved and awaiting payment.`);
+        loadCart();
+      } else {
+        setError(data?.error || 'Failed to place order. Please try again.');
+      }
     } finally {
       setCheckingOut(false);
     }
@@ -65,16 +127,62 @@ function Cart() {
     }
   };
 
-  const calculateTotal = () => {
-    if (!cart || !cart.items) return 0;
-    return cart.items.reduce((total, item) => total + (item.price * item.quantity), 0);
+  const handleSwitchCart = async (cartId) => {
+    try {
+      await activateCart(cartId);
+      loadCart();
+    } catch (error) {
+      setError(error.response?.data?.error || 'Could not switch carts.');
+    }
+  };
+
+  const handleNewCart = async () => {
+    const name = window.prompt('Name for the new cart');
+    if (!name) {
+      return;
+    }
+    try {
+      await createCart(name, true);
+      loadCart();
+    } catch (error) {
+      setError(error.response?.data?.error || 'Could not create cart.');
+    }
+  };
+
+  // Moves an item between the cart and the save for later list
+  const handleMoveItem = async (move, itemId) => {
+    try {
+      setError(null);
+      await move(itemId);
+      loadCart();
+    } catch (error) {
+      setError(error.response?.data?.error || 'Could not move item.');
+    }
+  };
+
+  const handleApplyCoupon = async (e) => {
+    e.preventDefault();
+    try {
+      setCouponError(null);
+      const data = await applyCoupon(couponCode);
+      setCart(data);
+      setCouponCode('');
+    } catch (error) {
+      setCouponError(error.response?.data?.error || 'Could not apply coupon.');
+    }
   };
 
-  const getTotalItems = () => {
-    if (!cart || !cart.items) return 0;
-    return cart.items.reduce((total, item) => total + item.quantity, 0);
+  const handleRemoveCoupon = async () => {
+    try {
+      setCouponError(null);
+      setCart(await removeCoupon());
+    } catch (error) {
+      setCouponError('Could not remove coupon.');
+    }
   };
 
+  const selectedShipping = shippingOptions.find((option) => option.code === shippingMethod);
+
   if (loading) {
     return (
       <div className="loading-container">
@@ -84,19 +192,82 @@ function Cart() {
     );
   }
 
+  const cartSwitcher = !isGuest && (
+    <div className="cart-switcher">
+      <select value={cart?.id || ''} onChange={(e) => handleSwitchCart(e.target.value)}>
+        {!carts.some((entry) => entry.status === 'active') && <option value="">Shopping Cart</option>}
+        {carts.map((entry) => (
+          <option key={entry.id} value={entry.id}>
+            {entry.name} ({entry.item_count} items, ${entry.total.formatted})
+          </option>
+        ))}
+      </select>
+      <button type="button" onClick={handleNewCart}>New cart</button>
+    </div>
+  );
+
+  const savedSection = saved && saved.items.length > 0 && (
+    <div className="saved-for-later">
+      <h2>Saved for later</h2>
+      {saved.items.map((item) => (
+        <div key={item.id} className="cart-item">
+          <div className="item-details">
+            <h3>{item.name}</h3>
+            <span>Quantity: {item.quantity}</span>
+          </div>
+          <div className="item-price">
+            <span className="amount">${item.line_total.formatted}</span>
+          </div>
+          <button type="button" onClick={() => handleMoveItem(moveToCart, item.id)}>
+            Move to cart
+          </button>
+        </div>
+      ))}
+    </div>
+  );
+
+  const unavailableSection = cart && cart.unavailable_items && cart.unavailable_items.length > 0 && (
+    <div className="unavailable-items">
+      <h2>No longer available</h2>
+      {cart.unavailable_items.map((item) => (
+        <div key={item.item_id} className="cart-item">
+          <div className="item-details">
+            <h3>{item.name}</h3>
+            <p>{item.reason}. It is not included in your total.</p>
+            <span>Quantity: {item.quantity}</span>
+          </div>
+          <button
+            className="delete-item-btn"
+            onClick={() => handleDeleteItem(item.item_id)}
+            title="Remove item"
+          >
+            <i className="fas fa-trash"></i>
+          </button>
+        </div>
+      ))}
+    </div>
+  );
+
   if (!cart || !cart.items || cart.items.length === 0) {
     return (
-      <div className="empty-cart">
-        <h2>Your cart is empty</h2>
-        <p>Add some products to your cart to see them here!</p>
-        <button onClick={() => navigate('/')}>Continue Shopping</button>
+      <div className="cart-container">
+        {cartSwitcher}
+        {error && <div className="error-message">{error}</div>}
+        <div className="empty-cart">
+          <h2>Your cart is empty</h2>
+          <p>Add some products to your cart to see them here!</p>
+          <button onClick={() => navigate('/')}>Continue Shopping</button>
+        </div>
+        {unavailableSection}
+        {savedSection}
       </div>
     );
   }
 
   return (
     <div className="cart-container">
-      <h1>Your Cart</h1>
+      <h1>{cart.name || 'Your Cart'}</h1>
+      {cartSwitcher}
       
       {error && (
         <div className="error-message">
@@ -121,13 +292,23 @@ function Cart() {
                 <div className="item-quantity">
                   <span>Quantity: {item.quantity}</span>
                 </div>
+                {!isGuest && (
+                  <button type="button" onClick={() => handleMoveItem(saveForLater, item.id)}>
+                    Save for later
+                  </button>
+                )}
               </div>
               <div className="item-price">
                 <span className="currency">$</span>
-                <span className="amount">{(item.price * item.quantity).toFixed(2)}</span>
+                <span className="amount">{item.line_total.formatted}</span>
                 <div className="price-per-item">
-                  ${item.price} each
+                  ${item.price.formatted} each
                 </div>
+                {item.discount.amount > 0 && (
+                  <div className="price-per-item">
+                    -${item.discount.formatted} off
+                  </div>
+                )}
               </div>
               <button 
                 className="delete-item-btn"
@@ -138,6 +319,7 @@ function Cart() {
               </button>
             </div>
           ))}
+          {unavailableSection}
         </div>
 
         <div className="cart-summary">
@@ -146,47 +328,145 @@ function Cart() {
           <div className="summary-details">
             <div className="summary-row">
               <span>Subtotal</span>
-              <span>${calculateTotal().toFixed(2)}</span>
+              <span>${cart.subtotal.formatted}</span>
             </div>
+            {cart.discount.amount > 0 && (
+              <div className="summary-row">
+                <span>Discount ({cart.coupon.code})</span>
+                <span>-${cart.discount.formatted}</span>
+              </div>
+            )}
             <div className="summary-row">
               <span>Shipping</span>
-              <span>Free</span>
+              <span>{selectedShipping ? `$${selectedShipping.cost.formatted}` : '-'}</span>
             </div>
             <div className="summary-row">
-              <span>Tax</span>
-              <span>Included</span>
+              <span>Tax{cart.tax_inclusive && ' (included)'}</span>
+              <span>${cart.tax.formatted}</span>
             </div>
             <div className="summary-row total">
               <span>Total</span>
-              <span>${calculateTotal().toFixed(2)}</span>
+              <span>${(selectedShipping ? selectedShipping.total : cart.total).formatted}</span>
             </div>
           </div>
 
-          <div className="summary-actions">
-            <button 
-              className={`checkout-button ${checkingOut ? 'loading' : ''}`}
-              onClick={handleCheckout}
-              disabled={checkingOut}
-            >
-              {checkingOut ? (
-                <>
-                  <div className="button-spinner"></div>
-                  Processing...
-                </>
+          {isGuest ? (
+            <div className="summary-actions">
+              <p>Log in to check out. Your cart will be kept.</p>
+              <button
+                className="checkout-button"
+                onClick={() => {
+                  localStorage.setItem('redirectPath', '/cart');
+                  navigate('/login');
+                }}
+              >
+                Log in to Checkout
+              </button>
+              <button className="continue-shopping-btn" onClick={() => navigate('/')}>
+                Continue Shopping
+              </button>
+            </div>
+          ) : (
+            <>
+            <form className="coupon-form" onSubmit={handleApplyCoupon}>
+              {cart.coupon ? (
+                <div className="summary-row">
+                  <span>
+                    Coupon {cart.coupon.code}
+                    {!cart.coupon.valid && ` - ${cart.coupon.error}`}
+                  </span>
+                  <button type="button" onClick={handleRemoveCoupon}>Remove</button>
+                </div>
+              ) : (
+                <div className="summary-row">
+                  <input
+                    type="text"
+                    placeholder="Coupon code"
+                    value={couponCode}
+                    onChange={(e) => setCouponCode(e.target.value)}
+                  />
+                  <button type="submit" disabled={!couponCode}>Apply</button>
+                </div>
+              )}
+              {couponError && <div className="error-message">{couponError}</div>}
+            </form>
+
+            <div className="shipping-address">
+              <h3>Ship to</h3>
+              {addresses.length > 0 ? (
+                <select value={addressId} onChange={(e) => setAddressId(e.target.value)}>
+                  {addresses.map((address) => (
+                    <option key={address.id} value={address.id}>
+                      {address.name}, {address.line1}, {address.city} {address.postal_code}
+                    </option>
+                  ))}
+                </select>
               ) : (
-                'Proceed to Checkout'
+                <p>No saved addresses yet.</p>
               )}
-            </button>
-            <button
-              className="continue-shopping-btn"
-              onClick={() => navigate('/')}
-              disabled={checkingOut}
-            >
-              Continue Shopping
-            </button>
-          </div>
+              <button type="button" onClick={() => navigate('/addresses')}>Manage addresses</button>
+            </div>
+
+            {addressId && (
+              <div className="shipping-method">
+                <h3>Delivery</h3>
+                {shippingOptions.length > 0 ? (
+                  shippingOptions.map((option) => (
+                    <label key={option.code}>
+                      <input
+                        type="radio"
+                        name="shipping_method"
+                        value={option.code}
+                        checked={shippingMethod === option.code}
+                        onChange={(e) => setShippingMethod(e.target.value)}
+                      />
+                      {option.name} ({option.min_days}-{option.max_days} days) - ${option.cost.formatted}
+                    </label>
+                  ))
+                ) : (
+                  <p>No delivery options for this address.</p>
+                )}
+              </div>
+            )}
+
+            <div className="payment-details">
+              <h3>Payment</h3>
+              <input
+                type="text"
+                placeholder="Payment token"
+                value={paymentToken}
+                onChange={(e) => setPaymentToken(e.target.value)}
+              />
+            </div>
+
+            <div className="summary-actions">
+              <button 
+                className={`checkout-button ${checkingOut ? 'loading' : ''}`}
+                onClick={handleCheckout}
+                disabled={checkingOut || !addressId || !shippingMethod || !paymentToken}
+              >
+                {checkingOut ? (
+                  <>
+                    <div className="button-spinner"></div>
+                    Processing...
+                  </>
+                ) : (
+                  'Proceed to Checkout'
+                )}
+              </button>
+              <button
+                className="continue-shopping-btn"
+                onClick={() => navigate('/')}
+                disabled={checkingOut}
+              >
+                Continue Shopping
+              </button>
+            </div>
+            </>
+          )}
         </div>
       </div>
+      {savedSection}
     </div>
   );
 }
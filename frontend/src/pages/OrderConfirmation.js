@@ -12,10 +12,6 @@ function OrderConfirmation() {
     return null;
   }
 
-  const calculateTotal = (items) => {
-    return items.reduce((total, item) => total + item.price, 0);
-  };
-
   return (
     <div className="order-confirmation">
       <div className="confirmation-content">
@@ -38,7 +34,9 @@ function OrderConfirmation() {
                 <div className="item-details">
                   <h3>{item.name}</h3>
                   <p>{item.description}</p>
-                  <span className="item-price">${item.price}</span>
+                  <span className="item-price">
+                    {item.quantity} × ${item.price.formatted} = ${item.line_total.formatted}
+                  </span>
                 </div>
               </div>
             ))}
@@ -47,19 +45,25 @@ function OrderConfirmation() {
           <div className="order-summary">
             <div className="summary-row">
               <span>Subtotal</span>
-              <span>${calculateTotal(orderDetails.items).toFixed(2)}</span>
+              <span>${orderDetails.subtotal.formatted}</span>
             </div>
+            {orderDetails.discount.amount > 0 && (
+              <div className="summary-row">
+                <span>Discount</span>
+                <span>-${orderDetails.discount.formatted}</span>
+              </div>
+            )}
             <div className="summary-row">
-              <span>Shipping</span>
-              <span>Free</span>
+              <span>Shipping{orderDetails.shipping_method && ` (${orderDetails.shipping_method})`}</span>
+              <span>{orderDetails.shipping.amount > 0 ? `$${orderDetails.shipping.formatted}` : 'Free'}</span>
             </div>
             <div className="summary-row">
-              <span>Tax</span>
-              <span>Included</span>
+              <span>Tax{orderDetails.tax_inclusive && ' (included)'}</span>
+              <span>${orderDetails.tax.formatted}</span>
             </div>
             <div className="summary-row total">
               <span>Total</span>
-              <span>${calculateTotal(orderDetails.items).toFixed(2)}</span>
+              <span>${orderDetails.total.formatted}</span>
             </div>
           </div>
         </div>
@@ -1,6 +1,6 @@
 import React, { useState, useEffect } from 'react';
 import { useNavigate } from 'react-router-dom';
-import { getOrders } from '../services/api';
+import { getOrders, reorder } from '../services/api';
 import './OrderHistory.css';
 
 function OrderHistory() {
@@ -27,8 +27,21 @@ function OrderHistory() {
     }
   };
 
-  const calculateOrderTotal = (items) => {
-    return items.reduce((total, item) => total + (item.price * (item.quantity || 1)), 0);
+  // Copies an order's items into the cart, saying which couldn't be added in
+  // full
+  const handleReorder = async (orderId) => {
+    try {
+      const result = await reorder(orderId);
+      const problems = [...result.adjusted, ...result.skipped]
+        .map((line) => `Item ${line.item_id}: ${line.reason}`);
+      if (problems.length > 0) {
+        alert(`Some items could not be added in full:\n${problems.join('\n')}`);
+      }
+      navigate('/cart');
+    } catch (error) {
+      console.error('Error reordering:', error);
+      alert('Could not add this order to your cart. Please try again.');
+    }
   };
 
   if (loading) {
@@ -94,7 +107,7 @@ function OrderHistory() {
                       <p className="item-description">{item.description}</p>
                       <div className="item-price">
                         <span className="currency">$</span>
-                        <span className="amount">{item.price.toFixed(2)}</span>
+                        <span className="amount">{item.price.formatted}</span>
                         {item.quantity && item.quantity > 1 && (
                           <span className="quantity">× {item.quantity}</span>
                         )}
@@ -111,9 +124,12 @@ function OrderHistory() {
               <div className="order-total">
                 <span>Total:</span>
                 <span className="total-amount">
-                  ${calculateOrderTotal(order.items).toFixed(2)}
+                  ${order.total.formatted}
                 </span>
               </div>
+              <button onClick={() => handleReorder(order.id)} className="reorder-btn">
+                Buy again
+              </button>
             </div>
           </div>
         ))}
@@ -1,6 +1,6 @@
 import React, { useState, useEffect } from 'react';
 import { useParams, useNavigate } from 'react-router-dom';
-import { getItem, addToCart } from '../services/api';
+import { getItem, addToCart, getWishlists, createWishlist, addToWishlist } from '../services/api';
 import './ProductDetail.css';
 
 function ProductDetail() {
@@ -16,6 +16,25 @@ function ProductDetail() {
     loadProduct();
   }, [id]);
 
+  // Adds the product to the user's first wishlist, starting one if needed
+  const handleAddToWishlist = async () => {
+    if (!localStorage.getItem('token')) {
+      localStorage.setItem('redirectPath', window.location.pathname);
+      navigate('/login');
+      return;
+    }
+    try {
+      setError(null);
+      const wishlists = await getWishlists();
+      const wishlist = wishlists[0] || await createWishlist('My Wishlist');
+      await addToWishlist(wishlist.id, product.id);
+      alert(`Added to ${wishlist.name}`);
+    } catch (error) {
+      console.error('Error adding to wishlist:', error);
+      setError(error.response?.data?.error || 'Error adding item to wishlist. Please try again.');
+    }
+  };
+
   const loadProduct = async () => {
     try {
       setLoading(true);
@@ -35,15 +54,7 @@ function ProductDetail() {
       setAddingToCart(true);
       setError(null);
       
-      // Check authentication
-      const token = localStorage.getItem('token');
-      if (!token) {
-        localStorage.setItem('redirectPath', window.location.pathname);
-        navigate('/login');
-        return;
-      }
-
-      // Add to cart with quantity
+      // Add to cart with quantity; guests get a cart of their own
       await addToCart(product.id, quantity);
       
       // Show success message and offer to view cart
@@ -108,7 +119,7 @@ function ProductDetail() {
           <div className="product-pricing">
             <div className="price">
               <span className="currency">$</span>
-              <span className="amount">{product.price}</span>
+              <span className="amount">{product.price.formatted}</span>
             </div>
             <div className="price-info">
               <span className="save-tag">Save 12%</span>
@@ -148,6 +159,9 @@ function ProductDetail() {
                 'Add to Cart'
               )}
             </button>
+            <button className="add-to-wishlist-button" onClick={handleAddToWishlist}>
+              <i className="fas fa-heart"></i> Wishlist
+            </button>
           </div>
 
           {error && (
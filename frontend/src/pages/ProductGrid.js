@@ -90,7 +90,7 @@ function ProductGrid() {
               <div className="product-footer">
                 <div className="product-price">
                   <span className="currency">$</span>
-                  <span className="amount">{product.price}</span>
+                  <span className="amount">{product.price.formatted}</span>
                 </div>
                 <button className="view-details-btn">
                   <span className="arrow-icon">→</span>
@@ -0,0 +1,202 @@
+import React, { useState, useEffect } from 'react';
+import { useParams } from 'react-router-dom';
+import {
+  getWishlists,
+  getWishlist,
+  createWishlist,
+  deleteWishlist,
+  removeFromWishlist,
+  shareWishlist,
+  unshareWishlist,
+  moveWishlistToCart,
+  getSharedWishlist
+} from '../services/api';
+import './Wishlists.css';
+
+// WishlistItems lists a wishlist's entries, flagging price drops and items
+// that sold out since they were added
+function WishlistItems({ items, onRemove }) {
+  if (items.length === 0) {
+    return <p>Nothing on this wishlist yet.</p>;
+  }
+  return (
+    <div className="wishlist-items">
+      {items.map((entry) => (
+        <div key={entry.item_id} className="wishlist-entry">
+          <img src={entry.image_urls || '/images/placeholder.svg'} alt={entry.name} />
+          <div className="wishlist-entry-details">
+            <h3>{entry.name}</h3>
+            <p>${entry.price.formatted}</p>
+            {entry.price_dropped && (
+              <span className="price-drop-badge">
+                Price dropped ${entry.price_drop.formatted} since you added it
+              </span>
+            )}
+            {entry.went_out_of_stock && <span className="out-of-stock-badge">Now out of stock</span>}
+          </div>
+          {onRemove && <button onClick={() => onRemove(entry.item_id)}>Remove</button>}
+        </div>
+      ))}
+    </div>
+  );
+}
+
+function Wishlists() {
+  const { token } = useParams();
+  const [wishlists, setWishlists] = useState([]);
+  const [selected, setSelected] = useState(null);
+  const [shareLink, setShareLink] = useState(null);
+  const [newName, setNewName] = useState('');
+  const [message, setMessage] = useState(null);
+  const [error, setError] = useState(null);
+  const [loading, setLoading] = useState(true);
+
+  useEffect(() => {
+    if (token) {
+      getSharedWishlist(token)
+        .then(setSelected)
+        .catch(() => setError('This wishlist is not available.'))
+        .finally(() => setLoading(false));
+    } else {
+      loadWishlists();
+    }
+  }, [token]);
+
+  const loadWishlists = async (selectId) => {
+    try {
+      setLoading(true);
+      const lists = await getWishlists();
+      setWishlists(lists);
+      const id = selectId || (lists[0] && lists[0].id);
+      setSelected(id ? await getWishlist(id) : null);
+    } catch (error) {
+      console.error('Error loading wishlists:', error);
+      setError('Failed to load wishlists. Please try again.');
+    } finally {
+      setLoading(false);
+    }
+  };
+
+  const handleSelect = async (id) => {
+    setShareLink(null);
+    setMessage(null);
+    setSelected(await getWishlist(id));
+  };
+
+  const handleCreate = async (e) => {
+    e.preventDefault();
+    try {
+      setError(null);
+      const wishlist = await createWishlist(newName);
+      setNewName('');
+      loadWishlists(wishlist.id);
+    } catch (error) {
+      setError(error.response?.data?.error || 'Failed to create wishlist.');
+    }
+  };
+
+  const handleDelete = async () => {
+    if (window.confirm(`Delete ${selected.name}?`)) {
+      await deleteWishlist(selected.id);
+      loadWishlists();
+    }
+  };
+
+  const handleRemove = async (itemId) => {
+    await removeFromWishlist(selected.id, itemId);
+    setSelected(await getWishlist(selected.id));
+  };
+
+  const handleShare = async () => {
+    const data = await shareWishlist(selected.id);
+    setShareLink(`${window.location.origin}/wishlists/shared/${data.share_token}`);
+    loadWishlists(selected.id);
+  };
+
+  const handleUnshare = async () => {
+    await unshareWishlist(selected.id);
+    setShareLink(null);
+    loadWishlists(selected.id);
+  };
+
+  const handleMoveToCart = async () => {
+    try {
+      setError(null);
+      const result = await moveWishlistToCart(selected.id);
+      const skipped = result.skipped.map((line) => `item ${line.item_id}: ${line.reason}`);
+      setMessage(`Moved ${result.added.length} items to your cart.` +
+        (skipped.length > 0 ? ` Left on the wishlist: ${skipped.join('; ')}.` : ''));
+      loadWishlists(selected.id);
+    } catch (error) {
+      setError('Failed to move items to your cart.');
+    }
+  };
+
+  if (loading) {
+    return (
+      <div className="wishlists-container loading-container">
+        <div className="spinner"></div>
+        <p>Loading wishlists...</p>
+      </div>
+    );
+  }
+
+  if (token) {
+    return (
+      <div className="wishlists-container">
+        {error && <div className="error-message">{error}</div>}
+        {selected && (
+          <div className="wishlist-panel">
+            <h1>{selected.name}</h1>
+            <WishlistItems items={selected.items} />
+          </div>
+        )}
+      </div>
+    );
+  }
+
+  return (
+    <div className="wishlists-container">
+      <h1>Your Wishlists</h1>
+
+      {error && <div className="error-message">{error}</div>}
+
+      <div className="wishlist-tabs">
+        {wishlists.map((wishlist) => (
+          <button
+            key={wishlist.id}
+            className={selected && selected.id === wishlist.id ? 'active' : ''}
+            onClick={() => handleSelect(wishlist.id)}
+          >
+            {wishlist.name} ({wishlist.item_count}){wishlist.shared && ' - shared'}
+          </button>
+        ))}
+        <form onSubmit={handleCreate}>
+          <input placeholder="New wishlist" value={newName} onChange={(e) => setNewName(e.target.value)} />
+          <button type="submit" disabled={!newName}>Create</button>
+        </form>
+      </div>
+
+      {selected && (
+        <div className="wishlist-panel">
+          <h2>{selected.name}</h2>
+          {message && <p className="wishlist-message">{message}</p>}
+          <WishlistItems items={selected.items} onRemove={handleRemove} />
+          <div className="wishlist-actions">
+            <button onClick={handleMoveToCart} disabled={selected.items.length === 0}>Move all to cart</button>
+            <button onClick={handleShare}>{selected.shared ? 'New share link' : 'Share'}</button>
+            {selected.shared && <button onClick={handleUnshare}>Stop sharing</button>}
+            <button onClick={handleDelete}>Delete</button>
+          </div>
+          {shareLink && (
+            <p className="wishlist-message">
+              Anyone with this link can view the wishlist: <a href={shareLink}>{shareLink}</a>
+            </p>
+          )}
+        </div>
+      )}
+    </div>
+  );
+}
+
+export default Wishlists;
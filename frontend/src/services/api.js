@@ -6,22 +6,63 @@ const api = axios.create({
   baseURL: API_URL,
 });
 
-// Add auth token to all requests
+// Add auth token to all requests, and the guest cart token if there is one
 api.interceptors.request.use((config) => {
   const token = localStorage.getItem('token');
   if (token) {
     config.headers.Authorization = `Bearer ${token}`;
   }
+  const cartToken = localStorage.getItem('cartToken');
+  if (cartToken) {
+    config.headers['X-Cart-Token'] = cartToken;
+  }
   return config;
 });
 
-// Handle auth errors
+const clearSession = () => {
+  localStorage.removeItem('token');
+  localStorage.removeItem('refreshToken');
+  localStorage.removeItem('username');
+};
+
+const saveTokens = (data) => {
+  localStorage.setItem('token', data.token);
+  if (data.refresh_token) {
+    localStorage.setItem('refreshToken', data.refresh_token);
+  }
+};
+
+// Handle auth errors, refreshing an expired access token once before giving up
 api.interceptors.response.use(
-  (response) => response,
-  (error) => {
+  (response) => {
+    // A guest's first add to cart hands out the token for their cart
+    const cartToken = response.headers['x-cart-token'];
+    if (cartToken) {
+      localStorage.setItem('cartToken', cartToken);
+    }
+    return response;
+  },
+  async (error) => {
+    const original = error.config;
+    const refreshToken = localStorage.getItem('refreshToken');
+    if (
+      error.response?.data?.code === 'token_expired' &&
+      refreshToken &&
+      !original._retried
+    ) {
+      original._retried = true;
+      try {
+        const response = await axios.post(`${API_URL}/users/refresh`, {
+          refresh_token: refreshToken,
+        });
+        saveTokens(response.data);
+        return api(original);
+      } catch (refreshError) {
+        // Fall through to the logout below
+      }
+    }
     if (error.response?.status === 401) {
-      localStorage.removeItem('token');
-      localStorage.removeItem('username');
+      clearSession();
       window.location.href = '/login';
     }
     return Promise.reject(error);
@@ -35,15 +76,38 @@ export const signup = async (username, password) => {
   return response.data;
 };
 
+// Logging in merges any guest cart into the user's cart, so the guest cart
+// token is no longer needed
 export const login = async (username, password) => {
   const response = await api.post('/users/login', { username, password });
-  localStorage.setItem('token', response.data.token);
+  saveTokens(response.data);
+  localStorage.removeItem('cartToken');
   localStorage.setItem('username', username);
   return response.data;
 };
 
-export const getItems = async () => {
-  const response = await api.get('/items');
+export const logout = async () => {
+  try {
+    await api.post('/users/logout');
+  } finally {
+    clearSession();
+  }
+};
+
+// Fetches one page of items; pass page, page_size, category, brand,
+// min_price, max_price, sort and order to narrow the listing
+export const getItemsPage = async (params = {}) => {
+  const response = await api.get('/items', { params });
+  return response.data;
+};
+
+export const getItems = async (params = {}) => {
+  const data = await getItemsPage({ page_size: 100, ...params });
+  return data.items;
+};
+
+export const searchItems = async (q, params = {}) => {
+  const response = await api.get('/items/search', { params: { q, ...params } });
   return response.data;
 };
 
@@ -65,34 +129,45 @@ export const getCart = async () => {
 };
 
 export const addToCart = async (itemId, quantity = 1) => {
-  try {
-    const response = await api.post('/carts', { 
-      item_id: itemId,
-      quantity: quantity
-    });
-    return response.data;
-  } catch (error) {
-    if (error.response?.status === 401) {
-      throw new Error('Please login to add items to cart');
-    }
-    throw error;
-  }
+  const response = await api.post('/carts', { 
+    item_id: itemId,
+    quantity: quantity
+  });
+  return response.data;
 };
 
-export const createOrder = async (cartId) => {
+// Pass the same idempotencyKey when retrying a checkout so it can't create a
+// second order
+export const createOrder = async (addressId, shippingMethod, paymentToken, idempotencyKey = crypto.randomUUID()) => {
   const response = await api.post('/orders', {
-    cart_id: cartId
+    address_id: addressId,
+    shipping_method: shippingMethod,
+    payment_token: paymentToken
+  }, {
+    headers: { 'Idempotency-Key': idempotencyKey }
   });
   return response.data;
 };
 
-export const getOrders = async () => {
-  const response = await api.get('/orders/me');
+export const payOrder = async (orderId, paymentToken, idempotencyKey = crypto.randomUUID()) => {
+  const response = await api.post(`/orders/${orderId}/pay`, {
+    payment_token: paymentToken
+  }, {
+    headers: { 'Idempotency-Key': idempotencyKey }
+  });
+  return response.data;
+};
+
+// Copies a past order's items into the active cart at current prices
+export const reorder = async (orderId, idempotencyKey = crypto.randomUUID()) => {
+  const response = await api.post(`/orders/${orderId}/reorder`, {}, {
+    headers: { 'Idempotency-Key': idempotencyKey }
+  });
   return response.data;
 };
 
-export const cleanupCart = async () => {
-  const response = await api.post('/carts/cleanup');
+export const getOrders = async () => {
+  const response = await api.get('/orders/me');
   return response.data;
 };
 
@@ -101,4 +176,154 @@ export const deleteCartItem = async (itemId) => {
     data: { item_id: itemId }
   });
   return response.data;
-};
\ No newline at end of file
+};
+
+export const updateCartItem = async (itemId, quantity) => {
+  const response = await api.put(`/carts/items/${itemId}`, { quantity });
+  return response.data;
+};
+
+export const applyCoupon = async (code) => {
+  const response = await api.post('/carts/coupon', { code });
+  return response.data;
+};
+
+export const removeCoupon = async () => {
+  const response = await api.delete('/carts/coupon');
+  return response.data;
+};
+
+export const getShippingOptions = async (addressId) => {
+  const response = await api.get('/carts/me/shipping-options', {
+    params: { address_id: addressId }
+  });
+  return response.data;
+};
+
+export const getAddresses = async () => {
+  const response = await api.get('/users/me/addresses');
+  return response.data;
+};
+
+export const createAddress = async (address) => {
+  const response = await api.post('/users/me/addresses', address);
+  return response.data;
+};
+
+export const updateAddress = async (id, address) => {
+  const response = await api.put(`/users/me/addresses/${id}`, address);
+  return response.data;
+};
+
+export const deleteAddress = async (id) => {
+  const response = await api.delete(`/users/me/addresses/${id}`);
+  return response.data;
+};
+
+export const setDefaultAddress = async (id) => {
+  const response = await api.post(`/users/me/addresses/${id}/default`);
+  return response.data;
+};
+
+// Named carts and the save for later list
+export const getCarts = async () => {
+  const response = await api.get('/users/me/carts');
+  return response.data;
+};
+
+export const createCart = async (name, active = false) => {
+  const response = await api.post('/users/me/carts', { name, active });
+  return response.data;
+};
+
+export const renameCart = async (id, name) => {
+  const response = await api.patch(`/users/me/carts/${id}`, { name });
+  return response.data;
+};
+
+export const deleteCart = async (id) => {
+  const response = await api.delete(`/users/me/carts/${id}`);
+  return response.data;
+};
+
+export const activateCart = async (id) => {
+  const response = await api.post(`/users/me/carts/${id}/activate`);
+  return response.data;
+};
+
+// Moves quantity units of an item between carts, or the whole line if
+// quantity is omitted
+export const moveCartItem = async (fromCartId, itemId, toCartId, quantity) => {
+  const response = await api.post(`/users/me/carts/${fromCartId}/items/${itemId}/move`, {
+    to_cart_id: toCartId,
+    quantity
+  });
+  return response.data;
+};
+
+export const getSavedForLater = async () => {
+  const response = await api.get('/carts/saved');
+  return response.data;
+};
+
+export const saveForLater = async (itemId) => {
+  const response = await api.post(`/carts/items/${itemId}/save-for-later`);
+  return response.data;
+};
+
+export const moveToCart = async (itemId) => {
+  const response = await api.post(`/carts/saved/${itemId}/move-to-cart`);
+  return response.data;
+};
+
+// Wishlists
+export const getWishlists = async () => {
+  const response = await api.get('/users/me/wishlists');
+  return response.data;
+};
+
+export const getWishlist = async (id) => {
+  const response = await api.get(`/users/me/wishlists/${id}`);
+  return response.data;
+};
+
+export const createWishlist = async (name) => {
+  const response = await api.post('/users/me/wishlists', { name });
+  return response.data;
+};
+
+export const deleteWishlist = async (id) => {
+  const response = await api.delete(`/users/me/wishlists/${id}`);
+  return response.data;
+};
+
+export const addToWishlist = async (id, itemId) => {
+  const response = await api.post(`/users/me/wishlists/${id}/items`, { item_id: itemId });
+  return response.data;
+};
+
+export const removeFromWishlist = async (id, itemId) => {
+  const response = await api.delete(`/users/me/wishlists/${id}/items/${itemId}`);
+  return response.data;
+};
+
+// Returns a new share token; earlier share links stop working
+export const shareWishlist = async (id) => {
+  const response = await api.post(`/users/me/wishlists/${id}/share`);
+  return response.data;
+};
+
+export const unshareWishlist = async (id) => {
+  const response = await api.delete(`/users/me/wishlists/${id}/share`);
+  return response.data;
+};
+
+export const moveWishlistToCart = async (id) => {
+  const response = await api.post(`/users/me/wishlists/${id}/move-to-cart`);
+  return response.data;
+};
+
+export const getSharedWishlist = async (token) => {
+  const response = await api.get(`/wishlists/shared/${token}`);
+  return response.data;
+};